@@ -0,0 +1,182 @@
+package jsonserv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CommonLogFormat is the Apache Common Log Format
+	CommonLogFormat = `%h %l %u %t "%r" %>s %b`
+	// CombinedLogFormat is the Apache Combined Log Format
+	CombinedLogFormat   = `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`
+	accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+	accessLogStart      = "access_log_start"
+)
+
+// accessLogEntry is what an access log line is made of
+type accessLogEntry struct {
+	req    *Request
+	res    *Response
+	start  time.Time
+	took   time.Duration
+	status int
+	size   int64
+}
+
+type accessLogDirective func(b *bytes.Buffer, e *accessLogEntry)
+
+// accessLogMiddleware writes a line per request once it is sent
+type accessLogMiddleware struct {
+	mu         sync.Mutex
+	w          io.Writer
+	directives []accessLogDirective
+	now        func() time.Time
+}
+
+// NewAccessLogMiddleware creates a middleware that writes a line per request to w in the
+// Apache log format, such as CommonLogFormat or CombinedLogFormat. Formats support %h, %l, %u,
+// %t, %r, %s, %>s, %b, %B, %D, %T, %m, %U, %q, %H, %v, %% and the request and response
+// headers %{Name}i and %{Name}o. It panics on unknown directives.
+func NewAccessLogMiddleware(w io.Writer, format string) Middleware {
+	directives, err := parseAccessLogFormat(format)
+	if err != nil {
+		panic(err)
+	}
+	return &accessLogMiddleware{w: w, directives: directives, now: time.Now}
+}
+
+func (m *accessLogMiddleware) Ingress(app interface{}, req *Request, res *Response) {
+	req.SetMiddlewareVar(accessLogStart, m.now())
+}
+
+func (m *accessLogMiddleware) Egress(app interface{}, req *Request, res *Response) {
+	start := req.GetMiddlewareVar(accessLogStart).(time.Time)
+	res.OnFinish(func() {
+		e := &accessLogEntry{req: req, res: res, start: start, took: m.now().Sub(start)}
+		e.status, e.size = res.Written()
+		if e.status == 0 {
+			e.status = res.Code
+		}
+		var b bytes.Buffer
+		for _, directive := range m.directives {
+			directive(&b, e)
+		}
+		b.WriteByte('\n')
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, err := m.w.Write(b.Bytes()); err != nil {
+			req.Log(LevelError, "Error writing access log", Field{Key: "error", Value: err})
+		}
+	})
+}
+
+func parseAccessLogFormat(format string) ([]accessLogDirective, error) {
+	var directives []accessLogDirective
+	literal := func(s string) accessLogDirective {
+		return func(b *bytes.Buffer, e *accessLogEntry) { b.WriteString(s) }
+	}
+	for len(format) > 0 {
+		i := strings.IndexByte(format, '%')
+		if i < 0 {
+			directives = append(directives, literal(format))
+			break
+		}
+		if i > 0 {
+			directives = append(directives, literal(format[:i]))
+		}
+		format = format[i+1:]
+		if strings.HasPrefix(format, ">") {
+			format = format[1:]
+		}
+		if strings.HasPrefix(format, "{") {
+			end := strings.Index(format, "}")
+			if end < 0 || end+1 >= len(format) {
+				return nil, fmt.Errorf("access log: unterminated %%{ in format")
+			}
+			name := format[1:end]
+			switch format[end+1] {
+			case 'i':
+				directives = append(directives, func(b *bytes.Buffer, e *accessLogEntry) {
+					writeAccessLogValue(b, e.req.Header().Get(name))
+				})
+			case 'o':
+				directives = append(directives, func(b *bytes.Buffer, e *accessLogEntry) {
+					writeAccessLogValue(b, e.res.Writer.Header().Get(name))
+				})
+			default:
+				return nil, fmt.Errorf("access log: unknown directive %%{%s}%c", name, format[end+1])
+			}
+			format = format[end+2:]
+			continue
+		}
+		if format == "" {
+			return nil, fmt.Errorf("access log: format ends with %%")
+		}
+		directive, ok := accessLogDirectives[format[0]]
+		if !ok {
+			return nil, fmt.Errorf("access log: unknown directive %%%c", format[0])
+		}
+		directives = append(directives, directive)
+		format = format[1:]
+	}
+	return directives, nil
+}
+
+var accessLogDirectives = map[byte]accessLogDirective{
+	'%': func(b *bytes.Buffer, e *accessLogEntry) { b.WriteByte('%') },
+	'h': func(b *bytes.Buffer, e *accessLogEntry) { b.WriteString(KeyByIP(e.req)) },
+	'l': func(b *bytes.Buffer, e *accessLogEntry) { b.WriteByte('-') },
+	'u': func(b *bytes.Buffer, e *accessLogEntry) {
+		user, _, _ := e.req.raw.BasicAuth()
+		writeAccessLogValue(b, user)
+	},
+	't': func(b *bytes.Buffer, e *accessLogEntry) {
+		b.WriteString("[" + e.start.Format(accessLogTimeFormat) + "]")
+	},
+	'r': func(b *bytes.Buffer, e *accessLogEntry) {
+		b.WriteString(escapeAccessLog(e.req.Method() + " " + e.req.raw.RequestURI + " " + e.req.raw.Proto))
+	},
+	's': func(b *bytes.Buffer, e *accessLogEntry) { b.WriteString(strconv.Itoa(e.status)) },
+	'b': func(b *bytes.Buffer, e *accessLogEntry) {
+		if e.size == 0 {
+			b.WriteByte('-')
+		} else {
+			b.WriteString(strconv.FormatInt(e.size, 10))
+		}
+	},
+	'B': func(b *bytes.Buffer, e *accessLogEntry) { b.WriteString(strconv.FormatInt(e.size, 10)) },
+	'D': func(b *bytes.Buffer, e *accessLogEntry) { b.WriteString(strconv.FormatInt(e.took.Microseconds(), 10)) },
+	'T': func(b *bytes.Buffer, e *accessLogEntry) {
+		b.WriteString(strconv.FormatInt(int64(e.took.Seconds()), 10))
+	},
+	'm': func(b *bytes.Buffer, e *accessLogEntry) { b.WriteString(e.req.Method()) },
+	'U': func(b *bytes.Buffer, e *accessLogEntry) { b.WriteString(escapeAccessLog(e.req.URL().Path)) },
+	'q': func(b *bytes.Buffer, e *accessLogEntry) {
+		if query := e.req.URL().RawQuery; query != "" {
+			b.WriteString("?" + escapeAccessLog(query))
+		}
+	},
+	'H': func(b *bytes.Buffer, e *accessLogEntry) { b.WriteString(e.req.raw.Proto) },
+	'v': func(b *bytes.Buffer, e *accessLogEntry) { writeAccessLogValue(b, e.req.raw.Host) },
+}
+
+// writeAccessLogValue writes a value, or - if it is empty
+func writeAccessLogValue(b *bytes.Buffer, value string) {
+	if value == "" {
+		b.WriteByte('-')
+		return
+	}
+	b.WriteString(escapeAccessLog(value))
+}
+
+// escapeAccessLog keeps clients from forging lines or breaking quoted fields
+func escapeAccessLog(s string) string {
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
+}
@@ -0,0 +1,53 @@
+package jsonserv
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAccessLogMiddleware_combined(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewAccessLogMiddleware(&buf, CombinedLogFormat).(*accessLogMiddleware)
+	m.now = func() time.Time {
+		return time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("", -7*3600))
+	}
+	s := New().AddMiddleware(m).
+		AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {
+			out.Ok(map[string]string{"hello": "world"})
+		})
+	r := httptest.NewRequest(http.MethodGet, "/?q=1", nil)
+	r.RemoteAddr = "10.0.0.1:5678"
+	r.SetBasicAuth("frank", "secret")
+	r.Header.Set("User-Agent", `curl "7"`)
+	s.createRouter().ServeHTTP(httptest.NewRecorder(), r)
+
+	expected := `10.0.0.1 - frank [02/Jan/2020:03:04:05 -0700] "GET /?q=1 HTTP/1.1" 200 18 "-" "curl \"7\""` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("Unexpected line:\n%s\n%s", buf.String(), expected)
+	}
+}
+
+func TestAccessLogMiddleware_custom(t *testing.T) {
+	var buf bytes.Buffer
+	s := New().AddMiddleware(NewAccessLogMiddleware(&buf, `%m %U%q %s %B %{Content-type}o 100%%`))
+	s.createRouter().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/gone?x=y", nil))
+	if buf.String() != "DELETE /gone?x=y 404 2 application/json 100%\n" {
+		t.Fatalf("Unexpected line: %q", buf.String())
+	}
+}
+
+func TestNewAccessLogMiddleware_invalid(t *testing.T) {
+	for _, format := range []string{"%z", "%{User-Agent}x", "%{User-Agent", "100%"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for %q", format)
+				}
+			}()
+			NewAccessLogMiddleware(&bytes.Buffer{}, format)
+		}()
+	}
+}
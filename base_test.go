@@ -2,9 +2,15 @@ package jsonserv
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
+	"testing"
 )
 
 type mockBody struct {
@@ -65,3 +71,57 @@ func mockWriter() *mockResponseWriter {
 	}
 
 }
+
+// requestOption changes a request before serve sends it
+type requestOption func(r *http.Request) *http.Request
+
+func withHeader(key, value string) requestOption {
+	return func(r *http.Request) *http.Request {
+		r.Header.Set(key, value)
+		return r
+	}
+}
+
+func withBody(body string) requestOption {
+	return func(r *http.Request) *http.Request {
+		r.Body = ioutil.NopCloser(strings.NewReader(body))
+		r.ContentLength = int64(len(body))
+		return r
+	}
+}
+
+func withContext(ctx context.Context) requestOption {
+	return func(r *http.Request) *http.Request {
+		return r.WithContext(ctx)
+	}
+}
+
+// viewServer serves a view on GET / behind middleware
+func viewServer(view View, middleware ...Middleware) *JsonServer {
+	s := New()
+	for _, m := range middleware {
+		s.AddMiddleware(m)
+	}
+	return s.AddRoute(http.MethodGet, "Index", "/", view)
+}
+
+// serve sends a request through the router of a server
+func serve(s *JsonServer, method, path string, options ...requestOption) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	for _, option := range options {
+		r = option(r)
+	}
+	w := httptest.NewRecorder()
+	s.createRouter().ServeHTTP(w, r)
+	return w
+}
+
+// serveJSON is serve for JSON object responses
+func serveJSON(t *testing.T, s *JsonServer, method, path string, options ...requestOption) (*httptest.ResponseRecorder, map[string]interface{}) {
+	w := serve(s, method, path, options...)
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid body %q: %v", w.Body.String(), err)
+	}
+	return w, body
+}
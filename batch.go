@@ -0,0 +1,226 @@
+package jsonserv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultBatchMaxRequests = 20
+	batchRouteName          = "Batch"
+)
+
+// BatchOptions configure the batch route
+type BatchOptions struct {
+	// MaxRequests is the most sub-requests in a batch, 20 if 0
+	MaxRequests int
+	// MaxBodySize limits the size of the whole batch, the MaxBodySize of the request if 0
+	MaxBodySize int64
+	// Parallelism is the number of sub-requests served at once, 1 if 0
+	Parallelism int
+}
+
+// BatchRequest is a sub-request of a batch
+type BatchRequest struct {
+	// ID names the sub-request for DependsOn
+	ID      string            `json:"id,omitempty"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	// DependsOn are the IDs of earlier sub-requests that have to succeed before this one is served
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// BatchResponse is the response to a sub-request. JSON bodies are embedded, other bodies are strings.
+type BatchResponse struct {
+	ID      string      `json:"id,omitempty"`
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    interface{} `json:"body,omitempty"`
+}
+
+// AddBatchRoute serves batches of sub-requests on a path. Each sub-request goes through the
+// router, middleware and views like any other request, inheriting the headers of the batch,
+// and the response is an array of their responses in order. Sub-requests whose dependencies
+// fail are not served and get a 424.
+func (s *JsonServer) AddBatchRoute(path string, options BatchOptions) *JsonServer {
+	if options.MaxRequests <= 0 {
+		options.MaxRequests = defaultBatchMaxRequests
+	}
+	if options.Parallelism <= 0 {
+		options.Parallelism = 1
+	}
+	return s.AddRoute(http.MethodPost, batchRouteName, path, func(app interface{}, r *Request, out *Response) {
+		s.serveBatch(r, out, options)
+	})
+}
+
+func (s *JsonServer) serveBatch(req *Request, res *Response, options BatchOptions) {
+	if res.Err != nil {
+		return
+	}
+	if options.MaxBodySize > 0 {
+		req.SetMiddlewareVar(MaxBodySize, options.MaxBodySize)
+	}
+	var batch []BatchRequest
+	if err := req.ParseBody(&batch); err != nil {
+		res.Error(err)
+		return
+	}
+	if len(batch) > options.MaxRequests {
+		res.Error(ErrBadRequest(fmt.Sprintf("Batches are limited to %d requests", options.MaxRequests)))
+		return
+	}
+	if err := s.validateBatch(batch); err != nil {
+		res.Error(err)
+		return
+	}
+
+	indexes := make(map[string]int)
+	for i, sub := range batch {
+		if sub.ID != "" {
+			indexes[sub.ID] = i
+		}
+	}
+	responses := make([]BatchResponse, len(batch))
+	done := make([]chan struct{}, len(batch))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	slots := make(chan struct{}, options.Parallelism)
+	var wg sync.WaitGroup
+	for i := range batch {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+			sub := batch[i]
+			for _, id := range sub.DependsOn {
+				dep := indexes[id]
+				<-done[dep]
+				if status := responses[dep].Status; status < 200 || status >= 300 {
+					responses[i] = BatchResponse{
+						ID:     sub.ID,
+						Status: http.StatusFailedDependency,
+						Body:   errorBody(req, NewHTTPError(http.StatusFailedDependency, "failed_dependency", "Request "+id+" failed")),
+					}
+					return
+				}
+			}
+			slots <- struct{}{}
+			responses[i] = s.dispatchBatch(req, sub)
+			<-slots
+		}(i)
+	}
+	wg.Wait()
+	res.Ok(responses)
+}
+
+// validateBatch checks the paths and dependencies of a batch
+func (s *JsonServer) validateBatch(batch []BatchRequest) error {
+	ids := make(map[string]int)
+	for i, sub := range batch {
+		if sub.Method == "" || !strings.HasPrefix(sub.Path, "/") || strings.HasPrefix(sub.Path, "//") {
+			return ErrBadRequest(fmt.Sprintf("Request %d needs a method and an absolute path", i))
+		}
+		if s.routesToBatch(sub) {
+			return ErrBadRequest(fmt.Sprintf("Request %d cannot be a batch", i))
+		}
+		if sub.ID != "" {
+			if _, ok := ids[sub.ID]; ok {
+				return ErrBadRequest(fmt.Sprintf("Duplicate request id %q", sub.ID))
+			}
+			ids[sub.ID] = i
+		}
+	}
+	// dependencies have to come first, which also rules out cycles
+	for i, sub := range batch {
+		for _, id := range sub.DependsOn {
+			if dep, ok := ids[id]; !ok || dep >= i {
+				return ErrBadRequest(fmt.Sprintf("Request %d depends on %q, which is not an earlier request", i, id))
+			}
+		}
+	}
+	return nil
+}
+
+// routesToBatch reports if the router would serve a sub-request with a batch route, however
+// its path is written
+func (s *JsonServer) routesToBatch(sub BatchRequest) bool {
+	raw, err := http.NewRequest(strings.ToUpper(sub.Method), sub.Path, nil)
+	if err != nil || s.router == nil {
+		return false
+	}
+	var match mux.RouteMatch
+	return s.router.Match(raw, &match) && match.Route != nil && match.Route.GetName() == batchRouteName
+}
+
+// dispatchBatch serves a sub-request through the router
+func (s *JsonServer) dispatchBatch(req *Request, sub BatchRequest) BatchResponse {
+	raw, err := http.NewRequestWithContext(req.Context(), strings.ToUpper(sub.Method), sub.Path, bytes.NewReader(sub.Body))
+	if err != nil {
+		return BatchResponse{ID: sub.ID, Status: http.StatusBadRequest, Body: errorBody(req, ErrBadRequest("Invalid request").Wrap(err))}
+	}
+	for key, values := range req.Header() {
+		raw.Header[key] = append([]string(nil), values...)
+	}
+	// the body of the sub-request is plain JSON, and the batch response is compressed as a whole
+	raw.Header.Del(headerContentEncoding)
+	raw.Header.Del(headerAcceptEncoding)
+	raw.Header.Del(headerContentLength)
+	raw.Header.Set(contentTypeHeader, contentTypeJson)
+	for key, value := range sub.Headers {
+		raw.Header.Set(key, value)
+	}
+	raw.RemoteAddr = req.raw.RemoteAddr
+	raw.Host = req.raw.Host
+
+	rec := &batchRecorder{header: make(http.Header)}
+	s.router.ServeHTTP(rec, raw)
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	response := BatchResponse{ID: sub.ID, Status: rec.code, Headers: rec.header}
+	rec.header.Del(headerContentLength)
+	if rec.body.Len() > 0 {
+		mediaType, _, _ := mime.ParseMediaType(rec.header.Get(contentTypeHeader))
+		if (mediaType == contentTypeJson || mediaType == contentTypeProblemJson) && json.Valid(rec.body.Bytes()) {
+			response.Body = json.RawMessage(bytes.TrimSpace(rec.body.Bytes()))
+		} else {
+			response.Body = rec.body.String()
+		}
+	}
+	return response
+}
+
+// batchRecorder records the response to a sub-request
+type batchRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *batchRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *batchRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *batchRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
@@ -0,0 +1,125 @@
+package jsonserv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func batchServer(options BatchOptions) *JsonServer {
+	return New().AddBatchRoute("/batch", options).
+		AddRoute(http.MethodGet, "User", "/users/{id}", func(app interface{}, r *Request, out *Response) {
+			if r.GetPathVar("id", "") == "404" {
+				out.Error(ErrNotFound("No such user"))
+				return
+			}
+			out.AddHeader("X-User", r.GetPathVar("id", ""))
+			out.Ok(map[string]string{"id": r.GetPathVar("id", ""), "auth": r.Header().Get("Authorization")})
+		}).
+		AddRoute(http.MethodPost, "Echo", "/echo", func(app interface{}, r *Request, out *Response) {
+			var body interface{}
+			if err := r.ParseBody(&body); err != nil {
+				out.Error(err)
+				return
+			}
+			out.Ok(body)
+		})
+}
+
+func serveBatch(t *testing.T, s *JsonServer, body string) (*httptest.ResponseRecorder, []BatchResponse) {
+	w := serve(s, http.MethodPost, "/batch", withBody(body), withHeader("Authorization", "token"))
+	var responses []BatchResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil {
+			t.Fatalf("Invalid body %q: %v", w.Body.String(), err)
+		}
+	}
+	return w, responses
+}
+
+func TestBatch(t *testing.T) {
+	_, responses := serveBatch(t, batchServer(BatchOptions{}), `[
+		{"method": "GET", "path": "/users/1"},
+		{"method": "post", "path": "/echo", "body": {"hello": "world"}, "headers": {"Authorization": "other"}},
+		{"method": "GET", "path": "/nowhere"}
+	]`)
+	if len(responses) != 3 {
+		t.Fatalf("Unexpected responses: %v", responses)
+	}
+	user := responses[0].Body.(map[string]interface{})
+	if responses[0].Status != http.StatusOK || user["id"] != "1" || user["auth"] != "token" {
+		t.Fatalf("Unexpected response: %v", responses[0])
+	}
+	if responses[0].Headers.Get("X-User") != "1" {
+		t.Fatalf("Unexpected headers: %v", responses[0].Headers)
+	}
+	if responses[1].Body.(map[string]interface{})["hello"] != "world" {
+		t.Fatalf("Unexpected response: %v", responses[1])
+	}
+	if responses[2].Status != http.StatusNotFound {
+		t.Fatalf("Unexpected response: %v", responses[2])
+	}
+}
+
+func TestBatch_dependencies(t *testing.T) {
+	_, responses := serveBatch(t, batchServer(BatchOptions{Parallelism: 4}), `[
+		{"id": "a", "method": "GET", "path": "/users/404"},
+		{"id": "b", "method": "GET", "path": "/users/2", "depends_on": ["a"]},
+		{"id": "c", "method": "GET", "path": "/users/3"},
+		{"id": "d", "method": "GET", "path": "/users/4", "depends_on": ["c"]}
+	]`)
+	for i, status := range []int{http.StatusNotFound, http.StatusFailedDependency, http.StatusOK, http.StatusOK} {
+		if responses[i].Status != status {
+			t.Fatalf("Unexpected status of %d: %d", i, responses[i].Status)
+		}
+	}
+}
+
+func TestBatch_parallelism(t *testing.T) {
+	var running, most int32
+	s := batchServer(BatchOptions{Parallelism: 2}).
+		AddRoute(http.MethodGet, "Slow", "/slow", func(app interface{}, r *Request, out *Response) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&most)
+				if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			out.Ok(nil)
+		})
+	serveBatch(t, s, `[{"method": "GET", "path": "/slow"}, {"method": "GET", "path": "/slow"}, {"method": "GET", "path": "/slow"}, {"method": "GET", "path": "/slow"}]`)
+	if most != 2 {
+		t.Fatalf("Unexpected parallelism: %d", most)
+	}
+}
+
+func TestBatch_invalid(t *testing.T) {
+	s := batchServer(BatchOptions{MaxRequests: 2})
+	for _, body := range []string{
+		`[{"method": "GET", "path": "/users/1"}, {"method": "GET", "path": "/users/2"}, {"method": "GET", "path": "/users/3"}]`,
+		`[{"method": "GET", "path": "http://example.com/"}]`,
+		`[{"method": "POST", "path": "/batch"}]`,
+		`[{"method": "POST", "path": "/%62atch"}]`,
+		`[{"method": "post", "path": "/batch/?x=1"}]`,
+		`[{"id": "a", "method": "GET", "path": "/users/1", "depends_on": ["a"]}]`,
+		`[{"method": "GET", "path": "/users/1", "depends_on": ["missing"]}]`,
+		`{}`,
+	} {
+		if w, _ := serveBatch(t, s, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: unexpected status %d", body, w.Code)
+		}
+	}
+}
+
+func TestBatch_body_size(t *testing.T) {
+	s := batchServer(BatchOptions{MaxBodySize: 16})
+	if w, _ := serveBatch(t, s, `[{"method": "GET", "path": "/users/1"}]`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Unexpected status: %d", w.Code)
+	}
+}
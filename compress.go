@@ -0,0 +1,286 @@
+package jsonserv
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingBrotli  = "br"
+	encodingAny     = "*"
+	// defaultMinCompressSize is the smallest body compressed by default, smaller bodies
+	// barely shrink or even grow
+	defaultMinCompressSize = 1024
+)
+
+// defaultCompressTypes are the media types compressed by default. Types ending in / match every subtype.
+var defaultCompressTypes = []string{
+	contentTypeJson,
+	contentTypeProblemJson,
+	contentTypeNDJSON,
+	"application/yaml",
+	"text/",
+}
+
+// CompressionOptions configure the compression middleware
+type CompressionOptions struct {
+	// Encodings are the encodings offered, preferred first: EncodingBrotli, EncodingGzip
+	// and EncodingDeflate. Gzip and deflate if empty.
+	Encodings []string
+	// Levels are the compression levels of the encodings, the default of an encoding if missing
+	Levels map[string]int
+	// MinSize is the smallest body compressed, 1024 bytes if 0. Bodies of unknown size are
+	// always compressed.
+	MinSize int
+	// ContentTypes are the media types compressed, JSON, YAML and text if empty. Types
+	// ending in / match every subtype.
+	ContentTypes []string
+}
+
+// compressor is implemented by the writers of every encoding
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressionMiddleware compresses responses with the encoding the client prefers
+type compressionMiddleware struct {
+	encodings    []string
+	pools        map[string]*sync.Pool
+	minSize      int
+	contentTypes []string
+}
+
+// NewCompressionMiddleware creates a middleware that compresses responses with the
+// Accept-Encoding the client prefers. It panics on unknown encodings or invalid levels.
+func NewCompressionMiddleware(options CompressionOptions) Middleware {
+	m := &compressionMiddleware{
+		encodings:    options.Encodings,
+		pools:        make(map[string]*sync.Pool),
+		minSize:      options.MinSize,
+		contentTypes: options.ContentTypes,
+	}
+	if len(m.encodings) == 0 {
+		m.encodings = []string{EncodingGzip, EncodingDeflate}
+	}
+	if m.minSize == 0 {
+		m.minSize = defaultMinCompressSize
+	}
+	if len(m.contentTypes) == 0 {
+		m.contentTypes = defaultCompressTypes
+	}
+	for _, encoding := range m.encodings {
+		level, ok := options.Levels[encoding]
+		newCompressor, err := compressorFactory(encoding, level, ok)
+		if err != nil {
+			panic(err)
+		}
+		m.pools[encoding] = &sync.Pool{New: func() interface{} {
+			return newCompressor()
+		}}
+	}
+	return m
+}
+
+// compressorFactory checks the level of an encoding and creates its writers
+func compressorFactory(encoding string, level int, hasLevel bool) (func() compressor, error) {
+	switch encoding {
+	case EncodingGzip:
+		if !hasLevel {
+			level = gzip.DefaultCompression
+		}
+		if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+			return nil, err
+		}
+		return func() compressor {
+			w, _ := gzip.NewWriterLevel(io.Discard, level)
+			return w
+		}, nil
+	case EncodingDeflate:
+		if !hasLevel {
+			level = zlib.DefaultCompression
+		}
+		if _, err := zlib.NewWriterLevel(io.Discard, level); err != nil {
+			return nil, err
+		}
+		return func() compressor {
+			w, _ := zlib.NewWriterLevel(io.Discard, level)
+			return w
+		}, nil
+	case EncodingBrotli:
+		if !hasLevel {
+			level = brotli.DefaultCompression
+		}
+		if level < brotli.BestSpeed || level > brotli.BestCompression {
+			return nil, fmt.Errorf("brotli: invalid compression level: %d", level)
+		}
+		return func() compressor {
+			return brotli.NewWriterLevel(io.Discard, level)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", encoding)
+}
+
+func (m *compressionMiddleware) Ingress(app interface{}, req *Request, res *Response) {
+	res.AddHeader(headerVary, headerAcceptEncoding)
+	encoding := m.negotiate(req.Header().Get(headerAcceptEncoding))
+	if encoding == "" {
+		return
+	}
+	cw := &compressWriter{
+		middleware: m,
+		writer:     res.Writer,
+		encoding:   encoding,
+	}
+	res.Writer = DecorateWriter(res.Writer, WriterDecorator{
+		Write:       cw.Write,
+		WriteHeader: cw.WriteHeader,
+		Flush:       cw.Flush,
+		Close:       cw.Close,
+	})
+}
+
+func (m *compressionMiddleware) Egress(app interface{}, req *Request, res *Response) {
+}
+
+// negotiate picks the offered encoding with the highest q-value, preferring earlier
+// encodings on ties. It is empty if the body should not be encoded.
+func (m *compressionMiddleware) negotiate(accept string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				value, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil || value < 0 || value > 1 {
+					value = 0
+				}
+				q = value
+			}
+		}
+		qualities[coding] = q
+	}
+	best, bestQ := "", 0.0
+	for _, encoding := range m.encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = qualities[encodingAny]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compresses reports if a content type is on the allowlist
+func (m *compressionMiddleware) compresses(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == contentTypeEventStream {
+		// event streams have to reach the client as they are flushed
+		return false
+	}
+	for _, allowed := range m.contentTypes {
+		if mediaType == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter decides to compress once the headers are written
+type compressWriter struct {
+	middleware  *compressionMiddleware
+	writer      ResponseWriter
+	encoding    string
+	compressor  compressor
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	header := cw.writer.Header()
+	if code == http.StatusNotModified {
+		// a 304 has no body, but carries the tag the compressed 200 would have
+		cw.codeETag(header)
+	}
+	if cw.shouldCompress(code, header) {
+		header.Set(headerContentEncoding, cw.encoding)
+		// the length of the uncompressed body no longer applies
+		header.Del(headerContentLength)
+		cw.codeETag(header)
+		cw.compressor = cw.middleware.pools[cw.encoding].Get().(compressor)
+		cw.compressor.Reset(cw.writer)
+	}
+	cw.writer.WriteHeader(code)
+}
+
+// codeETag gives the compressed body its own tag, which validators compare without the coding
+func (cw *compressWriter) codeETag(header http.Header) {
+	if etag := header.Get(headerETag); etag != "" {
+		header.Set(headerETag, codedETag(etag, cw.encoding))
+	}
+}
+
+func (cw *compressWriter) shouldCompress(code int, header http.Header) bool {
+	if !bodyAllowed(code) || header.Get(headerContentEncoding) != "" {
+		return false
+	}
+	if length := header.Get(headerContentLength); length != "" {
+		if n, err := strconv.Atoi(length); err == nil && n < cw.middleware.minSize {
+			return false
+		}
+	}
+	contentType := header.Get(contentTypeHeader)
+	return contentType == "" || cw.middleware.compresses(contentType)
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.compressor == nil {
+		return cw.writer.Write(data)
+	}
+	return cw.compressor.Write(data)
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.compressor != nil {
+		cw.compressor.Flush()
+	}
+	if f, ok := cw.writer.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Close() {
+	if cw.compressor != nil {
+		cw.compressor.Close()
+		cw.compressor.Reset(io.Discard)
+		cw.middleware.pools[cw.encoding].Put(cw.compressor)
+		cw.compressor = nil
+	}
+	cw.writer.Close()
+}
@@ -0,0 +1,112 @@
+package jsonserv
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompressionMiddleware_negotiate(t *testing.T) {
+	m := NewCompressionMiddleware(CompressionOptions{
+		Encodings: []string{EncodingBrotli, EncodingGzip, EncodingDeflate},
+	}).(*compressionMiddleware)
+	for accept, expected := range map[string]string{
+		"":                         "",
+		"identity":                 "",
+		"gzip":                     EncodingGzip,
+		"gzip;q=0":                 "",
+		"gzip, deflate, br":        EncodingBrotli,
+		"gzip;q=1, br;q=0.5":       EncodingGzip,
+		"*":                        EncodingBrotli,
+		"*;q=0.1, gzip;q=0.2":      EncodingGzip,
+		"br;q=0, *":                EncodingGzip,
+		"deflate;q=0.5, GZIP;q=.8": EncodingGzip,
+	} {
+		if encoding := m.negotiate(accept); encoding != expected {
+			t.Errorf("%q: expected %q, got %q", accept, expected, encoding)
+		}
+	}
+}
+
+func largeBody(app interface{}, r *Request, out *Response) {
+	out.Ok(map[string]string{"text": strings.Repeat("compress me ", 200)})
+}
+
+func TestCompressionMiddleware_brotli(t *testing.T) {
+	s := viewServer(largeBody, NewCompressionMiddleware(CompressionOptions{Encodings: []string{EncodingBrotli}}))
+	w := serve(s, http.MethodGet, "/", withHeader(headerAcceptEncoding, "br"))
+	if w.Header().Get(headerContentEncoding) != EncodingBrotli || w.Header().Get(headerContentLength) != "" {
+		t.Fatalf("Unexpected headers: %v", w.Header())
+	}
+	body, err := ioutil.ReadAll(brotli.NewReader(w.Body))
+	if err != nil || !bytes.Contains(body, []byte("compress me")) {
+		t.Fatalf("Unexpected body: %q %v", body, err)
+	}
+	if w.Header().Get(headerVary) != headerAcceptEncoding {
+		t.Fatalf("Unexpected Vary: %q", w.Header().Get(headerVary))
+	}
+}
+
+func TestCompressionMiddleware_deflate(t *testing.T) {
+	s := viewServer(largeBody, NewCompressionMiddleware(CompressionOptions{Levels: map[string]int{EncodingDeflate: zlib.BestSpeed}}))
+	w := serve(s, http.MethodGet, "/", withHeader(headerAcceptEncoding, "deflate"))
+	if w.Header().Get(headerContentEncoding) != EncodingDeflate {
+		t.Fatalf("Unexpected headers: %v", w.Header())
+	}
+	body, err := ioutil.ReadAll(zlibReader(t, w.Body))
+	if err != nil || !bytes.Contains(body, []byte("compress me")) {
+		t.Fatalf("Unexpected body: %q %v", body, err)
+	}
+}
+
+func TestCompressionMiddleware_skips_small_bodies(t *testing.T) {
+	s := viewServer(func(app interface{}, r *Request, out *Response) {
+		out.Ok(nil)
+	}, NewCompressionMiddleware(CompressionOptions{}))
+	w := serve(s, http.MethodGet, "/", withHeader(headerAcceptEncoding, "gzip"))
+	if w.Header().Get(headerContentEncoding) != "" || w.Body.String() != "{}" {
+		t.Fatalf("Unexpected response: %v %q", w.Header(), w.Body.String())
+	}
+	if w.Header().Get(headerContentLength) != "2" {
+		t.Fatalf("Unexpected length: %q", w.Header().Get(headerContentLength))
+	}
+}
+
+func TestCompressionMiddleware_content_types(t *testing.T) {
+	s := viewServer(largeBody, NewCompressionMiddleware(CompressionOptions{ContentTypes: []string{"text/"}}))
+	w := serve(s, http.MethodGet, "/", withHeader(headerAcceptEncoding, "gzip"))
+	if w.Header().Get(headerContentEncoding) != "" {
+		t.Fatalf("Unexpected encoding: %q", w.Header().Get(headerContentEncoding))
+	}
+}
+
+func TestNewCompressionMiddleware_invalid(t *testing.T) {
+	for _, options := range []CompressionOptions{
+		{Encodings: []string{"zstd"}},
+		{Levels: map[string]int{EncodingGzip: 42}},
+		{Encodings: []string{EncodingBrotli}, Levels: map[string]int{EncodingBrotli: 12}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for %v", options)
+				}
+			}()
+			NewCompressionMiddleware(options)
+		}()
+	}
+}
+
+func zlibReader(t *testing.T, r io.Reader) io.Reader {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		t.Fatalf("Invalid zlib stream: %v", err)
+	}
+	return zr
+}
@@ -0,0 +1,180 @@
+package jsonserv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const contentTypeCSV = "text/csv"
+
+// ErrUnsupportedBody is returned by encoders that can't write a body in their media type,
+// such as CSV encoders given an object. The response then fails with 406 Not Acceptable.
+var ErrUnsupportedBody = errors.New("body can't be written in this media type")
+
+// TabularEncoder is implemented by encoders whose media type can't hold an envelope, such
+// as CSV. Their bodies are never wrapped in envelope mode.
+type TabularEncoder interface {
+	Encoder
+	// Tabular marks the encoder and is never called
+	Tabular()
+}
+
+// normalize converts a body into the generic values encoding/json would produce, so
+// every encoder honors json tags and json.Marshaler. Numbers are kept as json.Number.
+func normalize(v interface{}) (interface{}, error) {
+	return normalizeJSON(jsonEncoder{}, v)
+}
+
+// normalizeJSON is normalize with the values written by a JSON encoder
+func normalizeJSON(enc jsonEncoder, v interface{}) (interface{}, error) {
+	buf := &bytes.Buffer{}
+	if err := enc.Encode(buf, v); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(buf)
+	dec.UseNumber()
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// csvEncoder writes lists as CSV with a header row
+type csvEncoder struct {
+}
+
+// NewCSVEncoder creates an encoder for text/csv. Bodies must be slices or arrays. Columns
+// are the json fields of struct elements in declaration order, otherwise the sorted keys of
+// the elements. Nested values are written as JSON.
+func NewCSVEncoder() Encoder {
+	return csvEncoder{}
+}
+
+func (e csvEncoder) ContentType() string {
+	return contentTypeCSV
+}
+
+func (e csvEncoder) Tabular() {}
+
+func (e csvEncoder) Encode(w io.Writer, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fmt.Errorf("csv: body is not a list: %w", ErrUnsupportedBody)
+	}
+	value, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	items, _ := value.([]interface{})
+	columns := csvColumns(rv.Type().Elem(), items)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	row := make([]string, len(columns))
+	for _, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			fields = map[string]interface{}{csvValueColumn: item}
+		}
+		for i, column := range columns {
+			row[i] = csvCell(fields[column])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvValueColumn is the column of lists that don't hold objects
+const csvValueColumn = "value"
+
+func csvColumns(elem reflect.Type, items []interface{}) []string {
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Struct {
+		return jsonFieldNames(elem)
+	}
+	keys := make(map[string]interface{})
+	for _, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return []string{csvValueColumn}
+		}
+		for key := range fields {
+			keys[key] = nil
+		}
+	}
+	return sortedKeys(keys)
+}
+
+// jsonFieldNames lists the names encoding/json uses for the fields of a struct
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				names = append(names, jsonFieldNames(embedded)...)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func csvCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
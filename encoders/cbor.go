@@ -0,0 +1,34 @@
+package encoders
+
+import (
+	"io"
+
+	"github.com/explodes/jsonserv"
+	"github.com/fxamacker/cbor/v2"
+)
+
+const contentTypeCBOR = "application/cbor"
+
+// cborMode writes map keys in the canonical order of RFC 7049
+var cborMode, _ = cbor.EncOptions{Sort: cbor.SortCanonical}.EncMode()
+
+// cborEncoder writes CBOR with canonically sorted map keys
+type cborEncoder struct {
+}
+
+// NewCBOREncoder creates an encoder for application/cbor
+func NewCBOREncoder() jsonserv.Encoder {
+	return cborEncoder{}
+}
+
+func (e cborEncoder) ContentType() string {
+	return contentTypeCBOR
+}
+
+func (e cborEncoder) Encode(w io.Writer, v interface{}) error {
+	value, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	return cborMode.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,53 @@
+// Package encoders provides jsonserv encoders for MessagePack, CBOR and YAML.
+//
+// Bodies are first converted into the generic values encoding/json would produce,
+// so every encoder honors json tags and json.Marshaler like the JSON responses do.
+package encoders
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// normalize converts a body into generic values. Nil bodies become empty maps, like
+// the "{}" of JSON, and numbers become int64, uint64 or float64.
+func normalize(v interface{}) (interface{}, error) {
+	if v == nil {
+		return map[string]interface{}{}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return convertNumbers(out), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = convertNumbers(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = convertNumbers(value)
+		}
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
@@ -0,0 +1,134 @@
+package encoders
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/explodes/jsonserv"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+type record struct {
+	ID      uint64    `json:"id"`
+	Name    string    `json:"name"`
+	Tags    []string  `json:"tags,omitempty"`
+	Score   float64   `json:"score"`
+	Created time.Time `json:"created"`
+	skip    bool
+}
+
+var testRecord = record{
+	ID:      1 << 63,
+	Name:    "one",
+	Score:   1.5,
+	Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+// expectedRecord is testRecord as the generic values of its JSON
+var expectedRecord = map[string]interface{}{
+	"id":      uint64(1 << 63),
+	"name":    "one",
+	"score":   1.5,
+	"created": "2020-01-02T03:04:05Z",
+}
+
+func encodeWith(t *testing.T, enc jsonserv.Encoder, v interface{}) []byte {
+	buf := &bytes.Buffer{}
+	if err := enc.Encode(buf, v); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMessagePackEncoder_Encode(t *testing.T) {
+	body := map[string]interface{}{"b": []interface{}{-1, "x", true, nil, 1.5, 300, -200}, "a": 1}
+	expected := []byte{
+		0x82,
+		0xa1, 'a', 0x01,
+		0xa1, 'b', 0x97, 0xff, 0xa1, 'x', 0xc3, 0xc0,
+		0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0xcd, 0x01, 0x2c,
+		0xd1, 0xff, 0x38,
+	}
+	if result := encodeWith(t, NewMessagePackEncoder(), body); !bytes.Equal(result, expected) {
+		t.Fatalf("Unexpected msgpack: % x", result)
+	}
+}
+
+func TestMessagePackEncoder_Encode_struct(t *testing.T) {
+	var decoded map[string]interface{}
+	if err := msgpack.Unmarshal(encodeWith(t, NewMessagePackEncoder(), testRecord), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, expectedRecord) {
+		t.Fatalf("Unexpected value: %#v", decoded)
+	}
+}
+
+func TestMessagePackEncoder_Encode_nil(t *testing.T) {
+	if result := encodeWith(t, NewMessagePackEncoder(), nil); !bytes.Equal(result, []byte{0x80}) {
+		t.Fatalf("Unexpected msgpack: % x", result)
+	}
+}
+
+func TestCBOREncoder_Encode(t *testing.T) {
+	body := map[string]interface{}{"bb": 1, "a": []interface{}{-1, 500, false, nil}}
+	expected := []byte{
+		0xa2,
+		0x61, 'a', 0x84, 0x20, 0x19, 0x01, 0xf4, 0xf4, 0xf6,
+		0x62, 'b', 'b', 0x01,
+	}
+	if result := encodeWith(t, NewCBOREncoder(), body); !bytes.Equal(result, expected) {
+		t.Fatalf("Unexpected cbor: % x", result)
+	}
+}
+
+func TestCBOREncoder_Encode_struct(t *testing.T) {
+	var decoded map[string]interface{}
+	if err := cbor.Unmarshal(encodeWith(t, NewCBOREncoder(), testRecord), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, expectedRecord) {
+		t.Fatalf("Unexpected value: %#v", decoded)
+	}
+}
+
+func TestYAMLEncoder_Encode(t *testing.T) {
+	body := map[string]interface{}{
+		"name":  "plain",
+		"quote": "yes",
+		"empty": []int{},
+		"items": []interface{}{
+			map[string]interface{}{"id": 1, "tags": []string{"a", "b: c"}},
+			[]int{1, 2},
+		},
+	}
+	expected := `empty: []
+items:
+  - id: 1
+    tags:
+      - a
+      - 'b: c'
+  - - 1
+    - 2
+name: plain
+quote: "yes"
+`
+	if result := encodeWith(t, NewYAMLEncoder(), body); string(result) != expected {
+		t.Fatalf("Unexpected yaml:\n%s", result)
+	}
+}
+
+func TestYAMLEncoder_Encode_struct(t *testing.T) {
+	var decoded map[string]interface{}
+	if err := yaml.Unmarshal(encodeWith(t, NewYAMLEncoder(), testRecord), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, expectedRecord) {
+		t.Fatalf("Unexpected value: %#v", decoded)
+	}
+}
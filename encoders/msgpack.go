@@ -0,0 +1,35 @@
+package encoders
+
+import (
+	"io"
+
+	"github.com/explodes/jsonserv"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const contentTypeMessagePack = "application/msgpack"
+
+// messagePackEncoder writes MessagePack with map keys in sorted order
+type messagePackEncoder struct {
+}
+
+// NewMessagePackEncoder creates an encoder for application/msgpack. Integers are written
+// in their smallest form.
+func NewMessagePackEncoder() jsonserv.Encoder {
+	return messagePackEncoder{}
+}
+
+func (e messagePackEncoder) ContentType() string {
+	return contentTypeMessagePack
+}
+
+func (e messagePackEncoder) Encode(w io.Writer, v interface{}) error {
+	value, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	enc := msgpack.NewEncoder(w)
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	return enc.Encode(value)
+}
@@ -0,0 +1,36 @@
+package encoders
+
+import (
+	"io"
+
+	"github.com/explodes/jsonserv"
+	"gopkg.in/yaml.v3"
+)
+
+const contentTypeYAML = "application/yaml"
+
+// yamlEncoder writes YAML with map keys in sorted order
+type yamlEncoder struct {
+}
+
+// NewYAMLEncoder creates an encoder for application/yaml
+func NewYAMLEncoder() jsonserv.Encoder {
+	return yamlEncoder{}
+}
+
+func (e yamlEncoder) ContentType() string {
+	return contentTypeYAML
+}
+
+func (e yamlEncoder) Encode(w io.Writer, v interface{}) error {
+	value, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(value); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,58 @@
+package jsonserv
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type encoderRecord struct {
+	ID    int64    `json:"id"`
+	Name  string   `json:"name"`
+	Tags  []string `json:"tags,omitempty"`
+	Score float64  `json:"score"`
+	skip  bool
+}
+
+func encodeWith(t *testing.T, enc Encoder, v interface{}) []byte {
+	buf := &bytes.Buffer{}
+	if err := enc.Encode(buf, v); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSVEncoder_Encode_structs(t *testing.T) {
+	body := []*encoderRecord{
+		{ID: 1, Name: "one", Tags: []string{"x"}, Score: 0.5},
+		{ID: 2, Name: "two, three"},
+	}
+	expected := "id,name,tags,score\n1,one,\"[\"\"x\"\"]\",0.5\n2,\"two, three\",,0\n"
+	if result := encodeWith(t, NewCSVEncoder(), body); string(result) != expected {
+		t.Fatalf("Unexpected csv:\n%s", result)
+	}
+}
+
+func TestCSVEncoder_Encode_not_a_list(t *testing.T) {
+	if err := NewCSVEncoder().Encode(&bytes.Buffer{}, map[string]int{}); !errors.Is(err, ErrUnsupportedBody) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCSVEncoder_object_not_acceptable(t *testing.T) {
+	s := New().
+		AddEncoder(NewCSVEncoder()).
+		AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {
+			out.Ok(map[string]int{"a": 1})
+		})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(headerAccept, contentTypeCSV)
+	w := httptest.NewRecorder()
+	s.createRouter().ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable || !strings.Contains(w.Body.String(), "not_acceptable") {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,154 @@
+package jsonserv
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerAccept = "Accept"
+	headerVary   = "Vary"
+)
+
+// Encoder writes response bodies in a media type
+type Encoder interface {
+	// ContentType is the media type written, such as "application/json"
+	ContentType() string
+	// Encode writes v. A nil v is an empty body.
+	Encode(w io.Writer, v interface{}) error
+}
+
+type encoders []Encoder
+
+// negotiate picks the encoder the Accept header prefers the most. Ties go to the
+// encoder added first, and a missing header accepts the first encoder.
+func (e encoders) negotiate(accept string) (Encoder, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return e[0], true
+	}
+	ranges := parseAccept(accept)
+	var best Encoder
+	bestQ := 0.0
+	for _, enc := range e {
+		if q := ranges.quality(enc.ContentType()); q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best, best != nil
+}
+
+// mediaRange is a single entry of an Accept header
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+type mediaRanges []mediaRange
+
+func parseAccept(accept string) mediaRanges {
+	var ranges mediaRanges
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype := splitMediaType(mediaType)
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// quality is the q-value of the most specific range matching the content type
+func (m mediaRanges) quality(contentType string) float64 {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return 0
+	}
+	typ, subtype := splitMediaType(mediaType)
+	q, specificity := 0.0, -1
+	for _, r := range m {
+		var s int
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+func splitMediaType(mediaType string) (string, string) {
+	if i := strings.IndexByte(mediaType, '/'); i >= 0 {
+		return mediaType[:i], mediaType[i+1:]
+	}
+	return mediaType, ""
+}
+
+// negotiateEncoder chooses the encoder of the response body before the view runs. Stream
+// routes check their own media type instead, and encode anything else as JSON. Ordinary
+// routes still run for clients that only accept a stream, such as EventSource, since the
+// view may stream, and checkStreamed fails them afterwards if it didn't.
+func (s *JsonServer) negotiateEncoder(req *Request, res *Response, streamType string) bool {
+	accept := req.Header().Get(headerAccept)
+	if streamType != "" {
+		if strings.TrimSpace(accept) != "" && parseAccept(accept).quality(streamType) == 0 {
+			res.Error(errNotAcceptable())
+			return false
+		}
+		return true
+	}
+	if len(s.encoders) > 1 {
+		res.Writer.Header().Add(headerVary, headerAccept)
+	}
+	enc, ok := s.encoders.negotiate(accept)
+	if !ok {
+		accepted := parseAccept(accept)
+		if accepted.quality(contentTypeEventStream) > 0 || accepted.quality(contentTypeNDJSON) > 0 {
+			res.streamOnly = true
+			return true
+		}
+		res.Error(errNotAcceptable())
+		return false
+	}
+	res.encoder = enc
+	return true
+}
+
+// checkStreamed fails responses of views that ran without an acceptable encoder, unless
+// they streamed a media type the client accepts
+func (s *JsonServer) checkStreamed(req *Request, res *Response) {
+	if !res.streamOnly || res.Err != nil {
+		return
+	}
+	var streamType string
+	switch {
+	case res.streamed:
+		streamType = res.Writer.Header().Get(contentTypeHeader)
+	case res.stream != nil && res.stream.ndjson:
+		streamType = contentTypeNDJSON
+	}
+	if streamType == "" || parseAccept(req.Header().Get(headerAccept)).quality(streamType) == 0 {
+		res.Error(errNotAcceptable())
+	}
+}
+
+func errNotAcceptable() *HTTPError {
+	return NewHTTPError(http.StatusNotAcceptable, "not_acceptable", "None of the accepted media types are available")
+}
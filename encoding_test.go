@@ -0,0 +1,93 @@
+package jsonserv
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// mediaTypeEncoder is an encoder that only has a content type
+type mediaTypeEncoder string
+
+func (e mediaTypeEncoder) ContentType() string {
+	return string(e)
+}
+
+func (e mediaTypeEncoder) Encode(w io.Writer, v interface{}) error {
+	return nil
+}
+
+func TestEncoders_negotiate(t *testing.T) {
+	const contentTypeMessagePack = "application/msgpack"
+	e := encoders{jsonEncoder{}, mediaTypeEncoder(contentTypeMessagePack), NewCSVEncoder()}
+	cases := map[string]string{
+		"":                                     contentTypeJson,
+		"*/*":                                  contentTypeJson,
+		"application/msgpack":                  contentTypeMessagePack,
+		"text/*, application/json;q=0.5":       contentTypeCSV,
+		"application/*;q=0.2, text/csv;q=0.1":  contentTypeJson,
+		"application/json;q=0, */*;q=0.1":      contentTypeMessagePack,
+		"text/html, application/msgpack;q=0.9": contentTypeMessagePack,
+	}
+	for accept, expected := range cases {
+		enc, ok := e.negotiate(accept)
+		if !ok {
+			t.Fatalf("No encoder for %q", accept)
+		}
+		if enc.ContentType() != expected {
+			t.Fatalf("Unexpected encoder for %q: %s", accept, enc.ContentType())
+		}
+	}
+}
+
+func TestEncoders_negotiate_no_match(t *testing.T) {
+	e := encoders{jsonEncoder{}}
+	for _, accept := range []string{"text/html", "application/json;q=0"} {
+		if _, ok := e.negotiate(accept); ok {
+			t.Fatalf("Unexpected encoder for %q", accept)
+		}
+	}
+}
+
+func TestJsonServer_AddEncoder(t *testing.T) {
+	s := New().
+		AddEncoder(NewCSVEncoder()).
+		AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {
+			out.Ok([]map[string]int{{"a": 1}})
+		})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(headerAccept, contentTypeCSV)
+	w := httptest.NewRecorder()
+	s.createRouter().ServeHTTP(w, r)
+
+	if w.Header().Get(contentTypeHeader) != contentTypeCSV {
+		t.Fatalf("Unexpected content type: %s", w.Header().Get(contentTypeHeader))
+	}
+	if w.Header().Get(headerVary) != headerAccept {
+		t.Fatal("Vary not set")
+	}
+	if w.Body.String() != "a\n1\n" {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+}
+
+func TestJsonServer_not_acceptable(t *testing.T) {
+	ran := false
+	s := New().AddRoute(http.MethodPost, "Create", "/", func(app interface{}, r *Request, out *Response) {
+		ran = true
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(headerAccept, "text/html")
+	w := httptest.NewRecorder()
+	s.createRouter().ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if ran {
+		t.Fatal("View ran without an acceptable encoder")
+	}
+}
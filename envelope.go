@@ -0,0 +1,50 @@
+package jsonserv
+
+// Warning is a non-fatal problem reported alongside the data of a response
+type Warning struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// envelope wraps every body in envelope mode
+type envelope struct {
+	Data     interface{}            `json:"data"`
+	Meta     map[string]interface{} `json:"meta"`
+	Errors   []interface{}          `json:"errors"`
+	Warnings []Warning              `json:"warnings"`
+}
+
+// AddMeta adds a member to the meta object of envelope mode
+func (r *Response) AddMeta(key string, value interface{}) *Response {
+	if r.meta == nil {
+		r.meta = make(map[string]interface{})
+	}
+	r.meta[key] = value
+	return r
+}
+
+// AddWarning reports a non-fatal problem in the warnings of envelope mode
+func (r *Response) AddWarning(code, message string) *Response {
+	r.warnings = append(r.warnings, Warning{Code: code, Message: message})
+	return r
+}
+
+// newEnvelope wraps a body or an error of a response
+func newEnvelope(res *Response, data interface{}, err interface{}) envelope {
+	e := envelope{
+		Data:     data,
+		Meta:     res.meta,
+		Errors:   []interface{}{},
+		Warnings: res.warnings,
+	}
+	if e.Meta == nil {
+		e.Meta = map[string]interface{}{}
+	}
+	if e.Warnings == nil {
+		e.Warnings = []Warning{}
+	}
+	if err != nil {
+		e.Errors = append(e.Errors, err)
+	}
+	return e
+}
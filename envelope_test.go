@@ -0,0 +1,120 @@
+package jsonserv
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestEnvelope_success(t *testing.T) {
+	s := New().SetEnvelope(true).
+		AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {
+			out.AddMeta("version", 2).
+				AddWarning("deprecated", "Use /v2").
+				Ok(map[string]string{"hello": "world"})
+		})
+	_, body := serveJSON(t, s, http.MethodGet, "/")
+	expected := map[string]interface{}{
+		"data":     map[string]interface{}{"hello": "world"},
+		"meta":     map[string]interface{}{"version": float64(2)},
+		"errors":   []interface{}{},
+		"warnings": []interface{}{map[string]interface{}{"code": "deprecated", "message": "Use /v2"}},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
+
+func TestEnvelope_error(t *testing.T) {
+	s := New().SetEnvelope(true).
+		AddRoute(http.MethodGet, "Missing", "/missing", func(app interface{}, r *Request, out *Response) {
+			out.Error(ErrNotFound(""))
+		})
+	w, body := serveJSON(t, s, http.MethodGet, "/missing")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	expected := map[string]interface{}{
+		"data":     nil,
+		"meta":     map[string]interface{}{},
+		"errors":   []interface{}{map[string]interface{}{"code": "not_found", "error": "Not Found"}},
+		"warnings": []interface{}{},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
+
+func TestEnvelope_problem_errors(t *testing.T) {
+	s := New().SetEnvelope(true).SetProblemJSON(true)
+	w, body := serveJSON(t, s, http.MethodGet, "/missing")
+	if w.Header().Get(contentTypeHeader) != contentTypeJson {
+		t.Fatalf("Unexpected content type: %s", w.Header().Get(contentTypeHeader))
+	}
+	problem := body["errors"].([]interface{})[0].(map[string]interface{})
+	if problem["status"] != float64(http.StatusNotFound) || problem["instance"] != "/missing" {
+		t.Fatalf("Unexpected problem: %v", problem)
+	}
+}
+
+func TestEnvelope_page(t *testing.T) {
+	s := New().SetEnvelope(true).
+		AddRoute(http.MethodGet, "Items", "/items", func(app interface{}, r *Request, out *Response) {
+			p, _ := r.Paginate(PageOptions{})
+			next, prev := p.Offsets(2, 3)
+			out.Page([]int{1, 2}, next, prev, 3)
+		})
+	_, body := serveJSON(t, s, http.MethodGet, "/items?limit=2")
+	if !reflect.DeepEqual(body["data"], []interface{}{float64(1), float64(2)}) {
+		t.Fatalf("Unexpected data: %v", body["data"])
+	}
+	page := body["meta"].(map[string]interface{})["page"].(map[string]interface{})
+	if page["next"] != "2" {
+		t.Fatalf("Unexpected page: %v", page)
+	}
+}
+
+func TestEnvelope_tabular(t *testing.T) {
+	s := New().SetEnvelope(true).AddEncoder(NewCSVEncoder()).
+		AddRoute(http.MethodGet, "Items", "/items", func(app interface{}, r *Request, out *Response) {
+			out.Ok([]map[string]int{{"a": 1}})
+		})
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set(headerAccept, contentTypeCSV)
+	w := httptest.NewRecorder()
+	s.createRouter().ServeHTTP(w, r)
+	if w.Body.String() != "a\n1\n" {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+}
+
+// lineEncoder writes bodies with fmt and opts out of the envelope
+type lineEncoder struct{}
+
+func (e lineEncoder) ContentType() string {
+	return "text/plain"
+}
+
+func (e lineEncoder) Encode(w io.Writer, v interface{}) error {
+	_, err := fmt.Fprintln(w, v)
+	return err
+}
+
+func (e lineEncoder) Tabular() {}
+
+func TestEnvelope_custom_tabular(t *testing.T) {
+	s := New().SetEnvelope(true).AddEncoder(lineEncoder{}).
+		AddRoute(http.MethodGet, "Items", "/items", func(app interface{}, r *Request, out *Response) {
+			out.Ok([]int{1, 2})
+		})
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set(headerAccept, "text/plain")
+	w := httptest.NewRecorder()
+	s.createRouter().ServeHTTP(w, r)
+	if w.Body.String() != "[1 2]\n" {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+}
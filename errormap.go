@@ -0,0 +1,52 @@
+package jsonserv
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// ErrorMapper turns an error into an HTTPError, or returns nil if it does not apply
+type ErrorMapper func(err error) *HTTPError
+
+type errorMappers []ErrorMapper
+
+// matchError creates a mapper for a target error. Nil pointers such as (*os.PathError)(nil)
+// match any error of that type using errors.As, other targets match using errors.Is.
+func matchError(target error, status int, code string) ErrorMapper {
+	var matches func(err error) bool
+	if t := reflect.ValueOf(target); t.Kind() == reflect.Ptr && t.IsNil() {
+		matches = func(err error) bool {
+			return errors.As(err, reflect.New(t.Type()).Interface())
+		}
+	} else {
+		matches = func(err error) bool {
+			return errors.Is(err, target)
+		}
+	}
+	return func(err error) *HTTPError {
+		if !matches(err) {
+			return nil
+		}
+		// mapped errors are public, so even 5xx statuses show their code and message
+		return NewHTTPError(status, code, http.StatusText(status)).Wrap(err)
+	}
+}
+
+// resolve applies the first matching mapper to errors that are not already HTTPErrors
+func (m errorMappers) resolve(res *Response) {
+	if res.Err == nil || res.streamed {
+		return
+	}
+	var httpErr *HTTPError
+	if errors.As(res.Err, &httpErr) {
+		return
+	}
+	for _, mapper := range m {
+		if httpErr = mapper(res.Err); httpErr != nil {
+			res.Err = httpErr
+			res.Code = asHTTPError(httpErr).Status
+			return
+		}
+	}
+}
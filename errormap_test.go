@@ -0,0 +1,112 @@
+package jsonserv
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestErrorMappers_resolve_errors_Is(t *testing.T) {
+	m := errorMappers{matchError(sql.ErrNoRows, http.StatusNotFound, "not_found")}
+	res := newResponse(mockWriter())
+	res.Error(fmt.Errorf("loading user: %w", sql.ErrNoRows))
+	m.resolve(res)
+
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("Unexpected code: %d", res.Code)
+	}
+	httpErr := asHTTPError(res.Err)
+	if httpErr.Code != "not_found" || httpErr.message() != "Not Found" {
+		t.Fatalf("Unexpected error: %v", httpErr)
+	}
+	if !errors.Is(res.Err, sql.ErrNoRows) {
+		t.Fatal("Cause lost")
+	}
+}
+
+func TestErrorMappers_resolve_errors_As(t *testing.T) {
+	m := errorMappers{matchError((*os.PathError)(nil), http.StatusServiceUnavailable, "storage")}
+	res := newResponse(mockWriter())
+	res.Error(&os.PathError{Op: "open", Path: "/tmp", Err: os.ErrPermission})
+	m.resolve(res)
+
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Unexpected code: %d", res.Code)
+	}
+}
+
+func TestErrorMappers_resolve_keeps_HTTPError(t *testing.T) {
+	m := errorMappers{func(err error) *HTTPError { return ErrConflict("mapped") }}
+	res := newResponse(mockWriter())
+	res.Error(ErrForbidden("explicit"))
+	m.resolve(res)
+
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("Unexpected code: %d", res.Code)
+	}
+}
+
+func TestErrorMappers_resolve_unmatched(t *testing.T) {
+	m := errorMappers{matchError(sql.ErrNoRows, http.StatusNotFound, "not_found")}
+	res := newResponse(mockWriter())
+	res.Error(errors.New("other"))
+	m.resolve(res)
+
+	if res.Code != http.StatusInternalServerError {
+		t.Fatalf("Unexpected code: %d", res.Code)
+	}
+}
+
+func TestJsonServer_MapErrorFunc(t *testing.T) {
+	errTaken := errors.New("taken")
+	s := New().
+		MapErrorFunc(func(err error) *HTTPError {
+			if errors.Is(err, errTaken) {
+				return ErrConflict("Username is taken")
+			}
+			return nil
+		}).
+		AddRoute(http.MethodGet, "Taken", "/", func(app interface{}, r *Request, out *Response) {
+			out.Error(errTaken)
+		})
+	w, body := serveJSON(t, s, http.MethodGet, "/")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if body["error"] != "Username is taken" {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
+
+func TestJsonServer_MapError_server_error(t *testing.T) {
+	errDown := errors.New("connection refused")
+	s := New().
+		MapError(errDown, http.StatusServiceUnavailable, "storage_down").
+		AddRoute(http.MethodGet, "Down", "/", func(app interface{}, r *Request, out *Response) {
+			out.Error(errDown)
+		})
+	w, body := serveJSON(t, s, http.MethodGet, "/")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if body["code"] != "storage_down" || body["error"] != "Service Unavailable" || body["cause"] != nil {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
+
+func TestJsonServer_MapErrorFunc_invalid_status(t *testing.T) {
+	s := New().
+		MapErrorFunc(func(err error) *HTTPError {
+			return &HTTPError{}
+		}).
+		AddRoute(http.MethodGet, "Broken", "/", func(app interface{}, r *Request, out *Response) {
+			out.Error(errors.New("secret"))
+		})
+	w, body := serveJSON(t, s, http.MethodGet, "/")
+	if w.Code != http.StatusInternalServerError || len(body) != 0 {
+		t.Fatalf("Unexpected response: %d %v", w.Code, body)
+	}
+}
@@ -0,0 +1,119 @@
+package jsonserv
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HTTPError is an error with a status code and a message that is safe to show to clients.
+// Views return them through Response.Error to answer with something other than a 500.
+type HTTPError struct {
+	// Status is the HTTP status code of the response
+	Status int
+	// Code is a machine readable error code, such as "invalid_email"
+	Code string
+	// Message is a human readable message shown to clients
+	Message string
+	// Details is optional extra information shown to clients, such as per-field errors
+	Details interface{}
+	// Err is the underlying cause, which is only shown to clients in debug mode
+	Err error
+	// Type is a URI identifying the problem type in problem+json responses
+	Type string
+}
+
+// NewHTTPError creates an error with the given status, code and message
+func NewHTTPError(status int, code, message string) *HTTPError {
+	return &HTTPError{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// ErrBadRequest creates a 400 error
+func ErrBadRequest(message string) *HTTPError {
+	return NewHTTPError(http.StatusBadRequest, "bad_request", message)
+}
+
+// ErrUnauthorized creates a 401 error
+func ErrUnauthorized(message string) *HTTPError {
+	return NewHTTPError(http.StatusUnauthorized, "unauthorized", message)
+}
+
+// ErrForbidden creates a 403 error
+func ErrForbidden(message string) *HTTPError {
+	return NewHTTPError(http.StatusForbidden, "forbidden", message)
+}
+
+// ErrNotFound creates a 404 error
+func ErrNotFound(message string) *HTTPError {
+	return NewHTTPError(http.StatusNotFound, "not_found", message)
+}
+
+// ErrConflict creates a 409 error
+func ErrConflict(message string) *HTTPError {
+	return NewHTTPError(http.StatusConflict, "conflict", message)
+}
+
+// ErrUnprocessable creates a 422 error
+func ErrUnprocessable(message string) *HTTPError {
+	return NewHTTPError(http.StatusUnprocessableEntity, "unprocessable_entity", message)
+}
+
+// WithDetails sets the details shown to clients
+func (e *HTTPError) WithDetails(details interface{}) *HTTPError {
+	e.Details = details
+	return e
+}
+
+// Wrap sets the underlying cause of the error
+func (e *HTTPError) Wrap(err error) *HTTPError {
+	e.Err = err
+	return e
+}
+
+func (e *HTTPError) Error() string {
+	message := e.message()
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", message, e.Err)
+	}
+	return message
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// message is the client facing message, falling back to the status text
+func (e *HTTPError) message() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return http.StatusText(e.Status)
+}
+
+// internalError wraps errors that were not meant for clients
+func internalError(err error) *HTTPError {
+	return &HTTPError{
+		Status: http.StatusInternalServerError,
+		Code:   "internal_error",
+		Err:    err,
+	}
+}
+
+// asHTTPError finds an HTTPError in the error's chain, or treats it as an internal error.
+// HTTPErrors without a valid status, such as literals missing one, are 500s.
+func asHTTPError(err error) *HTTPError {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		if httpErr.Status < 100 || httpErr.Status > 599 {
+			internal := *httpErr
+			internal.Status = http.StatusInternalServerError
+			return &internal
+		}
+		return httpErr
+	}
+	return internalError(err)
+}
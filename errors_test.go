@@ -0,0 +1,118 @@
+package jsonserv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHTTPError_Error(t *testing.T) {
+	err := ErrNotFound("no such user")
+	if err.Error() != "no such user" {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	err.Wrap(errors.New("row missing"))
+	if err.Error() != "no such user: row missing" {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestHTTPError_Error_falls_back_to_status_text(t *testing.T) {
+	err := &HTTPError{Status: http.StatusConflict}
+	if err.Error() != "Conflict" {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestHTTPError_Unwrap(t *testing.T) {
+	cause := errors.New("cause")
+	err := fmt.Errorf("context: %w", ErrConflict("taken").Wrap(cause))
+	if !errors.Is(err, cause) {
+		t.Fatal("Cause not found")
+	}
+	if asHTTPError(err).Status != http.StatusConflict {
+		t.Fatal("HTTPError not found")
+	}
+}
+
+func TestResponse_Error_uses_HTTPError_status(t *testing.T) {
+	res := newResponse(mockWriter())
+	res.Error(ErrForbidden("nope"))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("Unexpected code: %d", res.Code)
+	}
+}
+
+func TestResponse_Error_invalid_status(t *testing.T) {
+	for _, err := range []*HTTPError{{Message: "x"}, NewHTTPError(0, "broken", "x"), NewHTTPError(1000, "broken", "x")} {
+		s := New().AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {
+			out.Error(err)
+		})
+		w, body := serveJSON(t, s, http.MethodGet, "/")
+		if w.Code != http.StatusInternalServerError || body["error"] != "x" {
+			t.Fatalf("Unexpected response for %d: %d %v", err.Status, w.Code, body)
+		}
+	}
+}
+
+func TestWriteError_client_message_always_shown(t *testing.T) {
+	writer := mockWriter()
+	req := newRequest(mockRequest())
+	res := newResponse(writer)
+	res.Error(ErrUnprocessable("invalid").WithDetails(map[string]string{"email": "required"}).Wrap(errors.New("secret")))
+
+	if err := New().writeError(req, res); err != nil {
+		t.Fatal(err)
+	}
+	if writer.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Unexpected code: %d", writer.Code)
+	}
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(writer.Buffer.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["error"] != "invalid" || body["code"] != "unprocessable_entity" || body["details"] == nil {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+	if _, ok := body["cause"]; ok {
+		t.Fatal("Cause shown outside of debug mode")
+	}
+}
+
+func TestWriteError_internal_error_hidden(t *testing.T) {
+	writer := mockWriter()
+	req := newRequest(mockRequest())
+	res := newResponse(writer)
+	res.Error(errors.New("secret"))
+
+	if err := New().writeError(req, res); err != nil {
+		t.Fatal(err)
+	}
+	if writer.Code != http.StatusInternalServerError {
+		t.Fatalf("Unexpected code: %d", writer.Code)
+	}
+	if writer.Buffer.String() != "{}\n" {
+		t.Fatalf("Unexpected body: %s", writer.Buffer.String())
+	}
+}
+
+func TestWriteError_internal_error_shown_in_debug(t *testing.T) {
+	writer := mockWriter()
+	req := newRequest(mockRequest())
+	req.SetMiddlewareVar(DebugFlag, true)
+	res := newResponse(writer)
+	res.Error(errors.New("secret"))
+
+	if err := New().writeError(req, res); err != nil {
+		t.Fatal(err)
+	}
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(writer.Buffer.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["error"] != "secret" {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
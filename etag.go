@@ -0,0 +1,133 @@
+package jsonserv
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ETagFlag              = "etag"
+	headerETag            = "ETag"
+	headerLastModified    = "Last-Modified"
+	headerIfNoneMatch     = "If-None-Match"
+	headerIfModifiedSince = "If-Modified-Since"
+	weakETagPrefix        = "W/"
+)
+
+// etagMiddleware enables ETags hashed from response bodies
+type etagMiddleware struct {
+}
+
+// NewETagMiddleware creates a middleware that tags successful GET and HEAD responses with a hash
+// of their encoded body, and answers conditional requests with a 304 when it matches.
+// Views can set Response.ETag or Response.LastModified themselves to skip encoding unchanged bodies.
+func NewETagMiddleware() Middleware {
+	return &etagMiddleware{}
+}
+
+func (m etagMiddleware) Ingress(app interface{}, req *Request, res *Response) {
+	req.SetMiddlewareVar(ETagFlag, true)
+}
+
+func (m etagMiddleware) Egress(app interface{}, req *Request, res *Response) {
+}
+
+// conditional reports if a response can be answered with a 304
+func conditional(req *Request, res *Response) bool {
+	method := req.Method()
+	return (method == http.MethodGet || method == http.MethodHead) && res.Code == http.StatusOK
+}
+
+// setHashETag tags the response with a hash of the body if it is enabled and
+// the view didn't tag it already
+func setHashETag(req *Request, res *Response, body []byte) bool {
+	if res.ETag != "" || !conditional(req, res) || !req.GetOptionalMiddlewareVar(ETagFlag, false).(bool) {
+		return false
+	}
+	hash := fnv.New128a()
+	hash.Write(body)
+	res.ETag = hex.EncodeToString(hash.Sum(nil))
+	return true
+}
+
+// notModified sets the validator headers and reports if the client's copy is current
+func notModified(req *Request, res *Response) bool {
+	if !conditional(req, res) {
+		return false
+	}
+	header := res.Writer.Header()
+	if res.ETag != "" {
+		res.ETag = quoteETag(res.ETag)
+		header.Set(headerETag, res.ETag)
+	}
+	if !res.LastModified.IsZero() {
+		header.Set(headerLastModified, res.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if match := req.Header().Get(headerIfNoneMatch); match != "" {
+		return res.ETag != "" && etagListMatches(match, res.ETag, true)
+	}
+	if since := req.Header().Get(headerIfModifiedSince); since != "" && !res.LastModified.IsZero() {
+		t, err := http.ParseTime(since)
+		return err == nil && !res.LastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+func writeNotModified(res *Response) error {
+	res.Code = http.StatusNotModified
+	res.Writer.WriteHeader(http.StatusNotModified)
+	return nil
+}
+
+// quoteETag quotes an entity tag unless it already is
+func quoteETag(etag string) string {
+	if strings.HasSuffix(etag, `"`) && (strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, weakETagPrefix+`"`)) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// codedETag suffixes the opaque part of an entity tag with a content coding, so the
+// compressed and uncompressed bodies of a resource have different strong tags
+func codedETag(etag, encoding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + encoding + `"`
+}
+
+// uncodedETag removes the content coding added by codedETag
+func uncodedETag(etag string) string {
+	for _, encoding := range []string{EncodingGzip, EncodingDeflate, EncodingBrotli} {
+		if suffix := "-" + encoding + `"`; strings.HasSuffix(etag, suffix) {
+			return etag[:len(etag)-len(suffix)] + `"`
+		}
+	}
+	return etag
+}
+
+// etagListMatches compares the entity tags of an If-None-Match or If-Match header
+// with the current one. Weak comparison ignores the weak prefix, strong comparison
+// never matches weak tags. Tags match regardless of the content coding they were sent with.
+func etagListMatches(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		if etagsMatch(strings.TrimSpace(candidate), etag, weak) {
+			return true
+		}
+	}
+	return false
+}
+
+func etagsMatch(a, b string, weak bool) bool {
+	a, b = uncodedETag(a), uncodedETag(b)
+	if weak {
+		return strings.TrimPrefix(a, weakETagPrefix) == strings.TrimPrefix(b, weakETagPrefix)
+	}
+	return a == b && !strings.HasPrefix(a, weakETagPrefix)
+}
@@ -0,0 +1,120 @@
+package jsonserv
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func etagServer(view View) *JsonServer {
+	return viewServer(view, NewETagMiddleware(), NewGzipMiddleware())
+}
+
+func TestETagMiddleware_hashes_body(t *testing.T) {
+	s := etagServer(func(app interface{}, r *Request, out *Response) {
+		out.Ok(map[string]string{"hello": "world"})
+	})
+
+	w := serve(s, http.MethodGet, "/")
+	etag := w.Header().Get(headerETag)
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Unexpected response: %d %q", w.Code, etag)
+	}
+
+	w = serve(s, http.MethodGet, "/", withHeader(headerIfNoneMatch, `"other", `+etag))
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+
+	w = serve(s, http.MethodGet, "/", withHeader(headerIfNoneMatch, `"other"`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+}
+
+func TestETagMiddleware_with_gzip(t *testing.T) {
+	// large enough to be compressed
+	s := etagServer(func(app interface{}, r *Request, out *Response) {
+		out.Ok(map[string]string{"hello": strings.Repeat("world", 500)})
+	})
+
+	w := serve(s, http.MethodGet, "/", withHeader(headerAcceptEncoding, headerAcceptEncodingGzip))
+	etag := w.Header().Get(headerETag)
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `-gzip"`) {
+		t.Fatalf("Compressed ETag should have the coding: %s", etag)
+	}
+
+	w = serve(s, http.MethodGet, "/", withHeader(headerAcceptEncoding, headerAcceptEncodingGzip), withHeader(headerIfNoneMatch, etag))
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if w.Header().Get(headerETag) != etag {
+		t.Fatalf("Unexpected ETag: %s", w.Header().Get(headerETag))
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+}
+
+func TestETagMiddleware_view_validators(t *testing.T) {
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	encoded := false
+	s := etagServer(func(app interface{}, r *Request, out *Response) {
+		out.LastModified = modified
+		out.ETag = "v1"
+		out.Ok(encodeSpy(func() interface{} {
+			encoded = true
+			return nil
+		}))
+	})
+
+	w := serve(s, http.MethodGet, "/", withHeader(headerIfNoneMatch, `W/"v1"`))
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if w.Header().Get(headerETag) != `"v1"` || w.Header().Get(headerLastModified) != modified.Format(http.TimeFormat) {
+		t.Fatalf("Unexpected validators: %v", w.Header())
+	}
+	if encoded {
+		t.Fatal("Unchanged body was encoded")
+	}
+
+	w = serve(s, http.MethodGet, "/", withHeader(headerIfModifiedSince, modified.Format(http.TimeFormat)))
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	w = serve(s, http.MethodGet, "/", withHeader(headerIfModifiedSince, modified.Add(-time.Second).Format(http.TimeFormat)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+}
+
+func TestETagMiddleware_head(t *testing.T) {
+	s := New().
+		AddMiddleware(NewETagMiddleware()).
+		AddRoute(http.MethodHead, "Index", "/", func(app interface{}, r *Request, out *Response) {
+			out.Ok(map[string]string{"hello": "world"})
+		})
+	w := serve(s, http.MethodHead, "/")
+	etag := w.Header().Get(headerETag)
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Unexpected response: %d %v", w.Code, w.Header())
+	}
+
+	w = serve(s, http.MethodHead, "/", withHeader(headerIfNoneMatch, etag))
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+}
+
+// encodeSpy is a body that records when it is encoded
+type encodeSpy func() interface{}
+
+func (f encodeSpy) MarshalJSON() ([]byte, error) {
+	f()
+	return []byte("{}"), nil
+}
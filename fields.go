@@ -0,0 +1,165 @@
+package jsonserv
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	SelectableFields = "selectable_fields"
+	fieldsQuery      = "fields"
+)
+
+// fieldsMiddleware applies sparse fieldsets to response bodies
+type fieldsMiddleware struct {
+}
+
+// NewFieldsMiddleware creates a middleware that trims successful response bodies down to the
+// fields selected with ?fields=a,b.c,items.id. Nested fields are separated by dots and apply
+// to every element of arrays. Fields that aren't selectable fail with a 400. Routes declare
+// their selectable fields with WithSelectableFields, otherwise any field of the body is.
+func NewFieldsMiddleware() Middleware {
+	return &fieldsMiddleware{}
+}
+
+// WithSelectableFields wraps a view to declare the fields that ?fields may select.
+// Selecting a field also allows selecting the fields nested in it.
+func WithSelectableFields(view View, fields ...string) View {
+	return func(app interface{}, req *Request, res *Response) {
+		req.SetMiddlewareVar(SelectableFields, fields)
+		view(app, req, res)
+	}
+}
+
+func (m fieldsMiddleware) Ingress(app interface{}, req *Request, res *Response) {
+}
+
+func (m fieldsMiddleware) Egress(app interface{}, req *Request, res *Response) {
+	query, ok := req.URL().Query()[fieldsQuery]
+	if !ok || res.Err != nil || res.Body == nil {
+		return
+	}
+	paths := parseFields(query)
+	if len(paths) == 0 {
+		return
+	}
+	// normalized with the JSON options of the server, which the selected fields keep
+	body, err := normalizeJSON(jsonEncoder{options: req.jsonOptions}, res.Body)
+	if err != nil {
+		res.Error(err)
+		return
+	}
+	var unknown []string
+	selectable, declared := req.GetMiddlewareVar(SelectableFields).([]string)
+	for _, path := range paths {
+		if (declared && !fieldSelectable(selectable, path)) || (!declared && !fieldExists(body, path)) {
+			unknown = append(unknown, strings.Join(path, "."))
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		res.Error(ErrBadRequest("Unknown fields: " + strings.Join(unknown, ", ")).
+			WithDetails(map[string]interface{}{"fields": unknown}))
+		return
+	}
+	res.Body = selectFields(body, newFieldTree(paths))
+}
+
+// parseFields splits comma separated field lists into dotted paths
+func parseFields(query []string) [][]string {
+	var paths [][]string
+	for _, list := range query {
+		for _, field := range strings.Split(list, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				paths = append(paths, strings.Split(field, "."))
+			}
+		}
+	}
+	return paths
+}
+
+func fieldSelectable(selectable []string, path []string) bool {
+	field := strings.Join(path, ".")
+	for _, allowed := range selectable {
+		if field == allowed || strings.HasPrefix(field, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldExists reports if a path exists in any element of a normalized body
+func fieldExists(body interface{}, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+	switch v := body.(type) {
+	case map[string]interface{}:
+		value, ok := v[path[0]]
+		return ok && fieldExists(value, path[1:])
+	case []interface{}:
+		if len(v) == 0 {
+			return true
+		}
+		for _, item := range v {
+			if fieldExists(item, path) {
+				return true
+			}
+		}
+		return false
+	case nil:
+		return true
+	}
+	return false
+}
+
+// fieldTree holds the selected fields. An empty tree selects everything.
+type fieldTree map[string]fieldTree
+
+func newFieldTree(paths [][]string) fieldTree {
+	tree := make(fieldTree)
+	for _, path := range paths {
+		tree.add(path)
+	}
+	return tree
+}
+
+// add selects a path. Selecting a whole field wins over selecting some of its fields.
+func (t fieldTree) add(path []string) {
+	child, ok := t[path[0]]
+	if len(path) == 1 {
+		t[path[0]] = make(fieldTree)
+		return
+	}
+	if ok && len(child) == 0 {
+		return
+	}
+	if !ok {
+		child = make(fieldTree)
+		t[path[0]] = child
+	}
+	child.add(path[1:])
+}
+
+func selectFields(body interface{}, tree fieldTree) interface{} {
+	if len(tree) == 0 {
+		return body
+	}
+	switch v := body.(type) {
+	case map[string]interface{}:
+		selected := make(map[string]interface{}, len(tree))
+		for name, child := range tree {
+			if value, ok := v[name]; ok {
+				selected[name] = selectFields(value, child)
+			}
+		}
+		return selected
+	case []interface{}:
+		selected := make([]interface{}, len(v))
+		for i, item := range v {
+			selected[i] = selectFields(item, tree)
+		}
+		return selected
+	}
+	return body
+}
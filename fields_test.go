@@ -0,0 +1,109 @@
+package jsonserv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fieldsItem struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type fieldsBody struct {
+	ID     int          `json:"id"`
+	Title  string       `json:"title"`
+	Author fieldsItem   `json:"author"`
+	Items  []fieldsItem `json:"items"`
+}
+
+func fieldsServer(view View) *JsonServer {
+	return New().
+		AddMiddleware(NewFieldsMiddleware()).
+		AddRoute(http.MethodGet, "Index", "/", view)
+}
+
+func fieldsView(app interface{}, r *Request, out *Response) {
+	out.Ok(&fieldsBody{
+		ID:     1,
+		Title:  "title",
+		Author: fieldsItem{ID: 2, Name: "author"},
+		Items:  []fieldsItem{{ID: 3, Name: "a"}, {ID: 4, Name: "b"}},
+	})
+}
+
+func TestFieldsMiddleware_selects_fields(t *testing.T) {
+	w, body := serveJSON(t, fieldsServer(fieldsView), http.MethodGet, "/?fields=title,author.name,items.id")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	expected := map[string]interface{}{
+		"title":  "title",
+		"author": map[string]interface{}{"name": "author"},
+		"items":  []interface{}{map[string]interface{}{"id": float64(3)}, map[string]interface{}{"id": float64(4)}},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
+
+func TestFieldsMiddleware_whole_field_wins(t *testing.T) {
+	_, body := serveJSON(t, fieldsServer(fieldsView), http.MethodGet, "/?fields=author.name&fields=author")
+	expected := map[string]interface{}{
+		"author": map[string]interface{}{"id": float64(2), "name": "author"},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
+
+func TestFieldsMiddleware_unknown_field(t *testing.T) {
+	w, body := serveJSON(t, fieldsServer(fieldsView), http.MethodGet, "/?fields=title,items.missing,title.length")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	details := body["details"].(map[string]interface{})
+	if !reflect.DeepEqual(details["fields"], []interface{}{"items.missing", "title.length"}) {
+		t.Fatalf("Unexpected details: %v", details)
+	}
+}
+
+func TestFieldsMiddleware_selectable_fields(t *testing.T) {
+	s := fieldsServer(WithSelectableFields(fieldsView, "title", "items"))
+
+	w, body := serveJSON(t, s, http.MethodGet, "/?fields=items.name")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if len(body) != 1 || body["items"] == nil {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+
+	w, _ = serveJSON(t, s, http.MethodGet, "/?fields=id")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+}
+
+func TestFieldsMiddleware_without_query(t *testing.T) {
+	_, body := serveJSON(t, fieldsServer(fieldsView), http.MethodGet, "/")
+	if len(body) != 4 {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
+
+func TestFieldsMiddleware_json_options(t *testing.T) {
+	s := fieldsServer(func(app interface{}, r *Request, out *Response) {
+		out.Ok(map[string]interface{}{"at": time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), "id": int64(1 << 60)})
+	}).SetJSONOptions(JSONOptions{Int64AsString: true, TimeFormat: "2006-01-02"})
+	for _, path := range []string{"/", "/?fields=at,id"} {
+		w := httptest.NewRecorder()
+		s.createRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Body.String() != `{"at":"2020-01-02","id":"1152921504606846976"}`+"\n" {
+			t.Fatalf("Unexpected body for %s: %s", path, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package jsonserv
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	prettyQuery   = "pretty"
+	defaultIndent = "  "
+	// maxSafeInteger is the largest integer JavaScript represents exactly
+	maxSafeInteger = 1<<53 - 1
+)
+
+// JSONOptions configure how JSON bodies, including error bodies, are encoded
+type JSONOptions struct {
+	// Indent indents every body with the given string, such as "  "
+	Indent string
+	// DisableHTMLEscaping stops <, > and & in strings from being escaped
+	DisableHTMLEscaping bool
+	// Int64AsString writes integers that JavaScript can't represent exactly as strings
+	Int64AsString bool
+	// TimeFormat formats time.Time values with a layout instead of RFC 3339
+	TimeFormat string
+	// PrettyQuery indents the bodies of requests with a ?pretty query parameter
+	PrettyQuery bool
+	// PrettyDebug indents bodies in debug mode
+	PrettyDebug bool
+}
+
+// jsonEncoder is the default encoder. The zero value encodes like encoding/json.
+type jsonEncoder struct {
+	options JSONOptions
+	indent  string
+}
+
+func (e jsonEncoder) ContentType() string {
+	return contentTypeJson
+}
+
+func (e jsonEncoder) Encode(w io.Writer, v interface{}) error {
+	if v == nil {
+		_, err := io.WriteString(w, emptyBody)
+		return err
+	}
+	return e.encodeValue(w, v)
+}
+
+// encodeValue encodes a value that is not a whole body, so nil is null
+func (e jsonEncoder) encodeValue(w io.Writer, v interface{}) error {
+	if e.options.Int64AsString || e.options.TimeFormat != "" {
+		var err error
+		if v, err = transformJSON(v, e.options); err != nil {
+			return err
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(!e.options.DisableHTMLEscaping)
+	if e.indent != "" {
+		enc.SetIndent("", e.indent)
+	}
+	return enc.Encode(v)
+}
+
+// jsonEncoder creates the JSON encoder for a request, which is indented if requested
+func (s *JsonServer) jsonEncoder(req *Request) jsonEncoder {
+	enc := jsonEncoder{options: s.jsonOptions, indent: s.jsonOptions.Indent}
+	if enc.indent == "" && s.wantsPretty(req) {
+		enc.indent = defaultIndent
+	}
+	return enc
+}
+
+func (s *JsonServer) wantsPretty(req *Request) bool {
+	if s.jsonOptions.PrettyDebug && req.GetOptionalMiddlewareVar(DebugFlag, false).(bool) {
+		return true
+	}
+	if !s.jsonOptions.PrettyQuery {
+		return false
+	}
+	values, ok := req.URL().Query()[prettyQuery]
+	if !ok {
+		return false
+	}
+	// ?pretty and ?pretty=true are both on
+	pretty, err := strconv.ParseBool(values[0])
+	return values[0] == "" || (err == nil && pretty)
+}
+
+// transformJSON encodes a value with encoding/json and decodes it again, keeping the
+// order of object members, with times and large integers converted. The value is walked
+// alongside the decoded JSON, so only strings marshaled from a time.Time are times.
+func transformJSON(v interface{}, options JSONOptions) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return decodeTransformed(dec, reflect.ValueOf(v), options)
+}
+
+// decodeTransformed decodes the next value of a decoder, converting it with the options.
+// source is the value it was marshaled from, invalid if unknown.
+func decodeTransformed(dec *json.Decoder, source reflect.Value, options JSONOptions) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	source = jsonSource(source)
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			items := make([]interface{}, 0)
+			for i := 0; dec.More(); i++ {
+				var element reflect.Value
+				if (source.Kind() == reflect.Slice || source.Kind() == reflect.Array) && i < source.Len() {
+					element = source.Index(i)
+				}
+				item, err := decodeTransformed(dec, element, options)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			_, err := dec.Token()
+			return items, err
+		}
+		fields := make(jsonObject, 0)
+		for dec.More() {
+			name, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeTransformed(dec, memberSource(source, name.(string)), options)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, jsonField{name: name.(string), value: value})
+		}
+		_, err := dec.Token()
+		return fields, err
+	case json.Number:
+		return transformNumber(token, options), nil
+	case string:
+		if options.TimeFormat != "" && source.IsValid() && source.Type() == timeType {
+			return source.Interface().(time.Time).Format(options.TimeFormat), nil
+		}
+	}
+	return token, nil
+}
+
+// transformNumber writes integers that JavaScript can't represent exactly as strings
+func transformNumber(n json.Number, options JSONOptions) interface{} {
+	if !options.Int64AsString || strings.ContainsAny(n.String(), ".eE") {
+		return n
+	}
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil && i <= maxSafeInteger && i >= -maxSafeInteger {
+		return n
+	}
+	return n.String()
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// jsonSource follows pointers and interfaces to the value encoding/json marshaled.
+// Values that marshal themselves are unknown, except times.
+func jsonSource(v reflect.Value) reflect.Value {
+	for v.IsValid() && v.Type() != timeType {
+		if v.Kind() == reflect.Ptr && v.Type().Elem() == timeType {
+			v = v.Elem()
+			continue
+		}
+		if marshalsItself(v) {
+			return reflect.Value{}
+		}
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+			return v
+		}
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func marshalsItself(v reflect.Value) bool {
+	t := v.Type()
+	if t.Implements(marshalerType) || t.Implements(textMarshalerType) {
+		return true
+	}
+	p := reflect.PtrTo(t)
+	return v.CanAddr() && (p.Implements(marshalerType) || p.Implements(textMarshalerType))
+}
+
+// memberSource finds the map entry or struct field that marshaled to an object member
+func memberSource(v reflect.Value, name string) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			return v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if mapKeyName(iter.Key()) == name {
+				return iter.Value()
+			}
+		}
+	case reflect.Struct:
+		return structField(v, name)
+	}
+	return reflect.Value{}
+}
+
+// mapKeyName is the member name encoding/json gives a map key that is not a string
+func mapKeyName(k reflect.Value) string {
+	if m, ok := k.Interface().(encoding.TextMarshaler); ok {
+		b, _ := m.MarshalText()
+		return string(b)
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	return ""
+}
+
+// structField finds the field of a struct that marshaled to a member name. encoding/json
+// already dropped hidden and ambiguous fields, so the shallowest match wins, tagged first.
+func structField(v reflect.Value, name string) reflect.Value {
+	for level := []reflect.Value{v}; len(level) > 0; {
+		var match reflect.Value
+		tagged := false
+		var embedded []reflect.Value
+		for _, s := range level {
+			t := s.Type()
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				tag := f.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				tagName := strings.Split(tag, ",")[0]
+				if f.Anonymous && tagName == "" {
+					ft := f.Type
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if ft.Kind() == reflect.Struct {
+						if fv := reflect.Indirect(s.Field(i)); fv.IsValid() {
+							embedded = append(embedded, fv)
+						}
+						continue
+					}
+				}
+				if f.PkgPath != "" {
+					continue
+				}
+				fieldName := tagName
+				if fieldName == "" {
+					fieldName = f.Name
+				}
+				if fieldName == name && (!match.IsValid() || (tagName != "" && !tagged)) {
+					match, tagged = s.Field(i), tagName != ""
+				}
+			}
+		}
+		if match.IsValid() {
+			return match
+		}
+		level = embedded
+	}
+	return reflect.Value{}
+}
+
+// jsonObject is an object decoded by transformJSON, keeping the order of its members
+type jsonObject []jsonField
+
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := marshalUnescaped(field.name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := marshalUnescaped(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshalUnescaped leaves HTML escaping to the encoder of the whole body
+func marshalUnescaped(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
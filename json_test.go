@@ -0,0 +1,167 @@
+package jsonserv
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type jsonEmbedded struct {
+	Embedded string `json:"embedded"`
+	Name     string `json:"name"`
+}
+
+type jsonRecord struct {
+	jsonEmbedded
+	Name    string     `json:"name"`
+	ID      int64      `json:"id"`
+	Small   int64      `json:"small"`
+	Count   int        `json:"count,string"`
+	Created time.Time  `json:"created"`
+	Updated *time.Time `json:"updated,omitempty"`
+	HTML    string     `json:"html"`
+	Hidden  string     `json:"-"`
+}
+
+func TestJSONEncoder_Encode_options(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	body := map[string]interface{}{
+		"record": &jsonRecord{
+			jsonEmbedded: jsonEmbedded{Embedded: "e", Name: "shadowed"},
+			Name:         "name",
+			ID:           1 << 60,
+			Small:        42,
+			Count:        3,
+			Created:      created,
+			HTML:         "<b>",
+		},
+	}
+	enc := jsonEncoder{options: JSONOptions{
+		DisableHTMLEscaping: true,
+		Int64AsString:       true,
+		TimeFormat:          "2006-01-02",
+	}}
+	buf := &bytes.Buffer{}
+	if err := enc.Encode(buf, body); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"record":{"embedded":"e","name":"name","id":"1152921504606846976","small":42,"count":"3","created":"2020-01-02","html":"<b>"}}` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("Unexpected json: %s", buf.String())
+	}
+}
+
+func TestJSONEncoder_Encode_TimeFormat_only_times(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	body := map[string]interface{}{
+		"note":    "2020-01-02T03:04:05Z",
+		"times":   []interface{}{created, &created, "2020-01-02T03:04:05Z"},
+		"by_day":  map[int]time.Time{1: created},
+		"updated": &jsonRecord{Updated: &created},
+	}
+	enc := jsonEncoder{options: JSONOptions{TimeFormat: "2006-01-02"}}
+	buf := &bytes.Buffer{}
+	if err := enc.Encode(buf, body); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"by_day":{"1":"2020-01-02"},"note":"2020-01-02T03:04:05Z","times":["2020-01-02","2020-01-02","2020-01-02T03:04:05Z"],` +
+		`"updated":{"embedded":"","name":"","id":0,"small":0,"count":"0","created":"0001-01-01","updated":"2020-01-02","html":""}}` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("Unexpected json: %s", buf.String())
+	}
+}
+
+type jsonLeft struct {
+	Both string
+	Left string
+}
+
+type jsonRight struct {
+	Both  string
+	Right string
+}
+
+// jsonAmbiguous has the Both field twice at the same depth, which encoding/json omits
+type jsonAmbiguous struct {
+	jsonLeft
+	jsonRight
+	Big uint64 `json:"big"`
+}
+
+func TestJSONEncoder_Encode_options_field_rules(t *testing.T) {
+	body := jsonAmbiguous{jsonLeft{"l", "left"}, jsonRight{"r", "right"}, 7}
+	expected, _ := json.Marshal(body)
+	buf := &bytes.Buffer{}
+	if err := (jsonEncoder{options: JSONOptions{Int64AsString: true}}).Encode(buf, body); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(expected)+"\n" {
+		t.Fatalf("Unexpected json: %s", buf.String())
+	}
+}
+
+type jsonNode struct {
+	Next *jsonNode `json:"next"`
+}
+
+func TestJSONOptions_cycle(t *testing.T) {
+	node := &jsonNode{}
+	node.Next = node
+	s := New().
+		SetJSONOptions(JSONOptions{Int64AsString: true}).
+		AddRoute(http.MethodGet, "Cycle", "/", func(app interface{}, r *Request, out *Response) {
+			out.Ok(node)
+		})
+	w := httptest.NewRecorder()
+	s.createRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+}
+
+func TestJSONEncoder_Encode_escapes_html_by_default(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := (jsonEncoder{}).Encode(buf, "<b>"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `"\u003cb\u003e"`+"\n" {
+		t.Fatalf("Unexpected json: %s", buf.String())
+	}
+}
+
+func TestJSONOptions_PrettyQuery(t *testing.T) {
+	s := New().
+		SetJSONOptions(JSONOptions{PrettyQuery: true}).
+		AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {
+			out.Ok(map[string]int{"a": 1})
+		})
+	router := s.createRouter()
+	for path, expected := range map[string]string{
+		"/?pretty":       "{\n  \"a\": 1\n}\n",
+		"/?pretty=false": "{\"a\":1}\n",
+		"/":              "{\"a\":1}\n",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Body.String() != expected {
+			t.Fatalf("Unexpected body for %s: %q", path, w.Body.String())
+		}
+	}
+}
+
+func TestJSONOptions_PrettyDebug_errors(t *testing.T) {
+	s := New().
+		SetJSONOptions(JSONOptions{PrettyDebug: true}).
+		AddMiddleware(NewDebugFlagMiddleware(true)).
+		AddRoute(http.MethodGet, "Missing", "/missing", func(app interface{}, r *Request, out *Response) {
+			out.Error(ErrNotFound(""))
+		})
+	w := httptest.NewRecorder()
+	s.createRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Body.String() != "{\n  \"code\": \"not_found\",\n  \"error\": \"Not Found\"\n}\n" {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+}
@@ -0,0 +1,145 @@
+package jsonserv
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// Level is the severity of a log entry. The levels match those of log/slog.
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	return slog.Level(l).String()
+}
+
+// Field is a key and value of a structured log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger writes structured log entries
+type Logger interface {
+	Log(ctx context.Context, level Level, message string, fields ...Field)
+}
+
+// LogFieldFunc extracts fields from a request for every entry logged about it
+type LogFieldFunc func(req *Request) []Field
+
+// LogOptions configure what the framework logs
+type LogOptions struct {
+	// Level is the lowest level logged, LevelInfo by default
+	Level Level
+	// Fields are added to every entry logged about a request
+	Fields []LogFieldFunc
+	// SampleSuccess is the fraction of successful requests the logging middleware logs,
+	// all of them if 0. Failed requests are always logged.
+	SampleSuccess float64
+}
+
+// slogLogger adapts a *slog.Logger
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger creates a Logger writing to a log/slog logger
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Log(ctx context.Context, level Level, message string, fields ...Field) {
+	attrs := make([]slog.Attr, len(fields))
+	for i, field := range fields {
+		attrs[i] = slog.Any(field.Key, field.Value)
+	}
+	l.logger.LogAttrs(ctx, slog.Level(level), message, attrs...)
+}
+
+// stdLogger writes key=value lines to a standard library logger
+type stdLogger struct {
+	logger *log.Logger
+}
+
+// NewStdLogger creates a Logger writing "LEVEL message key=value ..." lines to a log package
+// logger. It is the default logger, writing to log.Default().
+func NewStdLogger(logger *log.Logger) Logger {
+	return &stdLogger{logger: logger}
+}
+
+func (l *stdLogger) Log(ctx context.Context, level Level, message string, fields ...Field) {
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(message)
+	for _, field := range fields {
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", field.Key, value)
+	}
+	l.logger.Print(b.String())
+}
+
+// SetLogger replaces the logger of every framework log entry
+func (s *JsonServer) SetLogger(logger Logger) *JsonServer {
+	s.logger = logger
+	return s
+}
+
+// SetLogOptions configures the levels, fields and sampling of framework log entries
+func (s *JsonServer) SetLogOptions(options LogOptions) *JsonServer {
+	s.logOptions = options
+	return s
+}
+
+// requestLogger adds the fields of a request to every entry
+type requestLogger struct {
+	req *Request
+}
+
+// Logger logs entries with the method, path and route of the request, and the fields of
+// the LogOptions. Entries below the level of the LogOptions are dropped.
+func (r *Request) Logger() Logger {
+	return requestLogger{req: r}
+}
+
+// Log logs an entry about the request
+func (r *Request) Log(level Level, message string, fields ...Field) {
+	r.Logger().Log(r.Context(), level, message, fields...)
+}
+
+func (l requestLogger) Log(ctx context.Context, level Level, message string, fields ...Field) {
+	logger, options := l.req.logger, l.req.logOptions
+	if logger == nil {
+		logger = NewStdLogger(log.Default())
+	}
+	if level < options.Level {
+		return
+	}
+	all := []Field{
+		{Key: "method", Value: l.req.Method()},
+		{Key: "path", Value: l.req.URL().Path},
+	}
+	if l.req.name != "" {
+		all = append(all, Field{Key: "route", Value: l.req.name})
+	}
+	if id := l.req.RequestID(); id != "" {
+		all = append(all, Field{Key: "request_id", Value: id})
+	}
+	for _, extract := range options.Fields {
+		all = append(all, extract(l.req)...)
+	}
+	logger.Log(ctx, level, message, append(all, fields...)...)
+}
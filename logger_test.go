@@ -0,0 +1,114 @@
+package jsonserv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type entry struct {
+	level   Level
+	message string
+	fields  map[string]interface{}
+}
+
+type recordingLogger struct {
+	entries []entry
+}
+
+func (l *recordingLogger) Log(ctx context.Context, level Level, message string, fields ...Field) {
+	e := entry{level: level, message: message, fields: make(map[string]interface{})}
+	for _, field := range fields {
+		e.fields[field.Key] = field.Value
+	}
+	l.entries = append(l.entries, e)
+}
+
+func loggedServer(logger Logger, options LogOptions) *JsonServer {
+	return New().SetLogger(logger).SetLogOptions(options).
+		AddMiddleware(NewLoggingMiddleware(true)).
+		AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {
+			out.Ok(map[string]string{"hello": "world"})
+		}).
+		AddRoute(http.MethodGet, "Panic", "/panic", func(app interface{}, r *Request, out *Response) {
+			panic("boom")
+		}).
+		AddRoute(http.MethodGet, "Conflict", "/conflict", func(app interface{}, r *Request, out *Response) {
+			out.Error(ErrConflict("taken"))
+		})
+}
+
+func TestLoggingMiddleware_fields(t *testing.T) {
+	logger := &recordingLogger{}
+	s := loggedServer(logger, LogOptions{
+		Fields: []LogFieldFunc{func(req *Request) []Field {
+			return []Field{{Key: "tenant", Value: req.Header().Get("X-Tenant")}}
+		}},
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant", "acme")
+	s.createRouter().ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(logger.entries) != 2 {
+		t.Fatalf("Unexpected entries: %v", logger.entries)
+	}
+	served := logger.entries[1]
+	if served.level != LevelInfo || served.fields["status"] != http.StatusOK || served.fields["route"] != "Index" {
+		t.Fatalf("Unexpected entry: %v", served)
+	}
+	if served.fields["bytes"] != int64(len(`{"hello":"world"}`)+1) || served.fields["tenant"] != "acme" || served.fields["path"] != "/" {
+		t.Fatalf("Unexpected entry: %v", served)
+	}
+}
+
+func TestLoggingMiddleware_levels_and_sampling(t *testing.T) {
+	logger := &recordingLogger{}
+	s := loggedServer(logger, LogOptions{Level: LevelWarn, SampleSuccess: 0.0001})
+	router := s.createRouter()
+	for i := 0; i < 10; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/conflict", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	var messages []string
+	for _, e := range logger.entries {
+		messages = append(messages, e.level.String()+" "+e.message)
+	}
+	expected := "WARN Request served,ERROR Panic serving request,ERROR Request served"
+	if strings.Join(messages, ",") != expected {
+		t.Fatalf("Unexpected entries: %v", messages)
+	}
+	if logger.entries[2].fields["error"] != "panic: boom" {
+		t.Fatalf("Unexpected entry: %v", logger.entries[2])
+	}
+}
+
+func TestNewSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	s := loggedServer(NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil))), LogOptions{})
+	s.createRouter().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["level"] != "INFO" || line["msg"] != "Request served" || line["status"] != float64(http.StatusNotFound) || line["route"] != "NotFound" {
+		t.Fatalf("Unexpected line: %v", line)
+	}
+}
+
+func TestNewStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	NewStdLogger(log.New(&buf, "", 0)).Log(context.Background(), LevelError, "Failed", Field{Key: "error", Value: "no luck"}, Field{Key: "n", Value: 1})
+	if buf.String() != "ERROR Failed error=\"no luck\" n=1\n" {
+		t.Fatalf("Unexpected line: %q", buf.String())
+	}
+}
@@ -1,10 +1,8 @@
 package jsonserv
 
 import (
-	"compress/gzip"
-	"log"
+	"math/rand"
 	"net/http"
-	"strings"
 	"time"
 )
 
@@ -29,10 +27,16 @@ type Middleware interface {
 
 type middlewares []Middleware
 
-func (m middlewares) Ingress(app interface{}, req *Request, res *Response) {
-	for _, middleware := range m {
+// Ingress runs the middleware in order until one halts the response, and returns
+// the middleware that ran, whose Egress should run
+func (m middlewares) Ingress(app interface{}, req *Request, res *Response) middlewares {
+	for i, middleware := range m {
 		middleware.Ingress(app, req, res)
+		if res != nil && res.halted {
+			return m[:i+1]
+		}
 	}
+	return m
 }
 
 func (m middlewares) Egress(app interface{}, req *Request, res *Response) {
@@ -77,8 +81,9 @@ type loggingMiddleware struct {
 	logIngress bool
 }
 
-// NewLoggingMiddleware creates middleware that will (optionally) log incoming requests (method, url)
-// and will log responses (method, code, url, duration)
+// NewLoggingMiddleware creates middleware that will (optionally) log incoming requests (method, path)
+// and will log responses (status, duration, bytes, error) with the logger of the server once they are sent.
+// Server errors are logged at LevelError, other responses with an error at LevelWarn and the rest at LevelInfo.
 func NewLoggingMiddleware(logIngress bool) Middleware {
 	return &loggingMiddleware{
 		logIngress: logIngress,
@@ -88,60 +93,42 @@ func NewLoggingMiddleware(logIngress bool) Middleware {
 func (m loggingMiddleware) Ingress(app interface{}, req *Request, res *Response) {
 	req.SetMiddlewareVar(StartTime, time.Now())
 	if m.logIngress {
-		log.Printf("← %s %s", req.Method(), req.URL())
+		req.Log(LevelInfo, "Request received")
 	}
 }
 
 func (m loggingMiddleware) Egress(app interface{}, req *Request, res *Response) {
 	start := req.GetMiddlewareVar(StartTime).(time.Time)
-	if res.Err != nil {
-		log.Printf("→ ERROR %s %d %s (%s): %v", req.Method(), res.Code, req.URL(), time.Now().Sub(start), res.Err)
-	} else {
-		log.Printf("→ %s %d %s (%s)", req.Method(), res.Code, req.URL(), time.Now().Sub(start))
-	}
-}
-
-// gzip middleware
-
-type gzipMiddleware struct {
+	res.OnFinish(func() {
+		status, size := res.Written()
+		if status == 0 {
+			status = res.Code
+		}
+		level := LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = LevelError
+		case res.Err != nil:
+			level = LevelWarn
+		case status < http.StatusBadRequest:
+			if rate := req.logOptions.SampleSuccess; rate > 0 && rand.Float64() >= rate {
+				return
+			}
+		}
+		fields := []Field{
+			{Key: "status", Value: status},
+			{Key: "duration", Value: time.Since(start)},
+			{Key: "bytes", Value: size},
+		}
+		if res.Err != nil {
+			fields = append(fields, Field{Key: "error", Value: res.Err.Error()})
+		}
+		req.Log(level, "Request served", fields...)
+	})
 }
 
 // NewGzipMiddleware creates a middleware that will compress responses using
 // gzip if the requesting entity supports it via the Accept-Encoding header
 func NewGzipMiddleware() Middleware {
-	return &gzipMiddleware{}
-}
-
-func (m gzipMiddleware) Ingress(app interface{}, req *Request, res *Response) {
-	if strings.Contains(req.Header().Get(headerAcceptEncoding), headerAcceptEncodingGzip) {
-		res.Writer = &gzipWriter{
-			writer: res.Writer,
-			gz:     gzip.NewWriter(res.Writer),
-		}
-		res.AddHeader(headerContentEncoding, headerContentEncodingGzip)
-	}
-}
-
-func (m gzipMiddleware) Egress(app interface{}, req *Request, res *Response) {
-}
-
-type gzipWriter struct {
-	writer ResponseWriter
-	gz     *gzip.Writer
-}
-
-func (gz *gzipWriter) Header() http.Header {
-	return gz.writer.Header()
-}
-
-func (gz *gzipWriter) Write(data []byte) (int, error) {
-	return gz.gz.Write(data)
-}
-
-func (gz *gzipWriter) WriteHeader(code int) {
-	gz.writer.WriteHeader(code)
-}
-
-func (gz *gzipWriter) Close() {
-	gz.gz.Close()
+	return NewCompressionMiddleware(CompressionOptions{Encodings: []string{EncodingGzip}})
 }
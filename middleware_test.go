@@ -104,9 +104,13 @@ func TestGzipMiddleware_Wraps_Gzip_Accepted_ResponsesContentTypeIsSet(t *testing
 	req.Header().Add(headerAcceptEncoding, headerAcceptEncodingGzip)
 	gz.Ingress(nil, req, res)
 
-	if _, ok := res.Writer.(*gzipWriter); !ok {
+	if _, ok := res.Writer.(DecoratedWriter); !ok {
 		t.Fatal("Writer not wrapped")
 	}
+	res.Writer.Write([]byte("{}"))
+	if res.Writer.Header().Get(headerContentEncoding) != headerContentEncodingGzip {
+		t.Fatal("Content encoding not set")
+	}
 
 }
 
@@ -118,7 +122,7 @@ func TestGzipMiddleware_Doesnt_wrap_non_Gzip_Accepted_ResponsesContentTypeIsSet(
 	req.Header().Add(headerAcceptEncoding, "none")
 	gz.Ingress(nil, req, res)
 
-	if _, ok := res.Writer.(*gzipWriter); ok {
+	if _, ok := res.Writer.(DecoratedWriter); ok {
 		t.Fatal("Writer wrapped")
 	}
 
@@ -159,13 +163,13 @@ func TestGzipWriter_CompressesCorrectly(t *testing.T) {
 	}
 
 	writer := mockWriter()
-	gzWriter := &gzipWriter{
-		writer: writer,
-		gz:     gzip.NewWriter(writer),
-	}
+	res := newResponse(writer)
+	req := newRequest(mockRequest())
+	req.Header().Add(headerAcceptEncoding, headerAcceptEncodingGzip)
+	NewGzipMiddleware().Ingress(nil, req, res)
 
-	n, err := gzWriter.Write(contents)
-	gzWriter.Close()
+	n, err := res.Writer.Write(contents)
+	res.Writer.Close()
 	if err != nil {
 		t.Fatalf("Unable to compress contents: %v", err)
 	}
@@ -208,7 +212,7 @@ func TestGzipMiddleware_RoundTrip(t *testing.T) {
 
 	res.Writer.Write(contents)
 	// Close usually happens during response but we need to force it here to check output
-	res.Writer.(*gzipWriter).Close()
+	res.Writer.Close()
 
 	results := writer.Buffer.Bytes()
 	if !reflect.DeepEqual(results, expected) {
@@ -0,0 +1,271 @@
+package jsonserv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	Paging              = "paging"
+	limitQuery          = "limit"
+	offsetQuery         = "offset"
+	cursorQuery         = "cursor"
+	headerLink          = "Link"
+	defaultPageLimit    = 20
+	defaultMaxPageLimit = 100
+	cursorSignatureSize = 16
+)
+
+// PageMode is how list views page through results
+type PageMode int
+
+const (
+	// OffsetPaging pages with ?limit= and ?offset=
+	OffsetPaging PageMode = iota
+	// CursorPaging pages with ?limit= and an opaque ?cursor=
+	CursorPaging
+)
+
+// PageOptions configure how Paginate reads paging parameters
+type PageOptions struct {
+	Mode PageMode
+	// DefaultLimit is the limit without ?limit=, 20 if unset
+	DefaultLimit int
+	// MaxLimit is the largest ?limit= accepted, 100 if unset
+	MaxLimit int
+	// Signer signs cursors so clients can't forge them. Unsigned cursors are only encoded.
+	Signer *CursorSigner
+}
+
+// Pagination is the page a list view should serve
+type Pagination struct {
+	Mode  PageMode
+	Limit int
+	// Offset is the number of items to skip in offset paging
+	Offset int
+	// Cursor is the position to continue from in cursor paging, empty on the first page
+	Cursor string
+	signer *CursorSigner
+}
+
+// Paginate reads and validates the paging parameters of the request. Invalid
+// parameters fail with a 400.
+func (r *Request) Paginate(options PageOptions) (*Pagination, error) {
+	if options.DefaultLimit <= 0 {
+		options.DefaultLimit = defaultPageLimit
+	}
+	if options.MaxLimit <= 0 {
+		options.MaxLimit = defaultMaxPageLimit
+	}
+	query := r.URL().Query()
+	p := &Pagination{
+		Mode:   options.Mode,
+		Limit:  options.DefaultLimit,
+		signer: options.Signer,
+	}
+	if value := query.Get(limitQuery); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > options.MaxLimit {
+			return nil, ErrBadRequest(fmt.Sprintf("limit must be between 1 and %d", options.MaxLimit))
+		}
+		p.Limit = limit
+	}
+	switch options.Mode {
+	case OffsetPaging:
+		if value := query.Get(offsetQuery); value != "" {
+			offset, err := strconv.Atoi(value)
+			if err != nil || offset < 0 {
+				return nil, ErrBadRequest("offset must be a positive number")
+			}
+			p.Offset = offset
+		}
+	case CursorPaging:
+		if value := query.Get(cursorQuery); value != "" {
+			cursor, err := options.Signer.Decode(value)
+			if err != nil {
+				return nil, ErrBadRequest("Invalid cursor").Wrap(err)
+			}
+			p.Cursor = cursor
+		}
+	}
+	r.SetMiddlewareVar(Paging, p)
+	return p, nil
+}
+
+// Offsets are the offsets of the next and previous pages of offset paging, empty
+// when there is no such page. Count is the number of items on this page and total the
+// number of all items. When the total is unknown (negative) a full page has a next page.
+func (p *Pagination) Offsets(count int, total int64) (next, prev string) {
+	if (total < 0 && count >= p.Limit && p.Limit > 0) || int64(p.Offset+p.Limit) < total {
+		next = strconv.Itoa(p.Offset + p.Limit)
+	}
+	if p.Offset > 0 {
+		prevOffset := p.Offset - p.Limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		prev = strconv.Itoa(prevOffset)
+	}
+	return next, prev
+}
+
+// CursorSigner signs cursors with HMAC-SHA256
+type CursorSigner struct {
+	key []byte
+}
+
+// NewCursorSigner creates a signer with a secret key
+func NewCursorSigner(key []byte) *CursorSigner {
+	return &CursorSigner{key: key}
+}
+
+// Encode makes an opaque cursor of a position. A nil signer only encodes it.
+func (s *CursorSigner) Encode(position string) string {
+	cursor := base64.RawURLEncoding.EncodeToString([]byte(position))
+	if s == nil {
+		return cursor
+	}
+	return cursor + "." + base64.RawURLEncoding.EncodeToString(s.sign(position))
+}
+
+// Decode verifies a cursor and returns its position
+func (s *CursorSigner) Decode(cursor string) (string, error) {
+	encoded, signature := cursor, ""
+	if s != nil {
+		i := strings.LastIndexByte(cursor, '.')
+		if i < 0 {
+			return "", errors.New("cursor is not signed")
+		}
+		encoded, signature = cursor[:i], cursor[i+1:]
+	}
+	position, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if s != nil {
+		mac, err := base64.RawURLEncoding.DecodeString(signature)
+		if err != nil || !hmac.Equal(mac, s.sign(string(position))) {
+			return "", errors.New("cursor signature mismatch")
+		}
+	}
+	return string(position), nil
+}
+
+func (s *CursorSigner) sign(position string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(position))
+	return mac.Sum(nil)[:cursorSignatureSize]
+}
+
+// page is a page of items waiting for the request to build its links
+type page struct {
+	items      interface{}
+	next, prev string
+	total      int64
+}
+
+// pageBody is the envelope of a page
+type pageBody struct {
+	Items interface{} `json:"items"`
+	Page  pageMeta    `json:"page"`
+}
+
+type pageMeta struct {
+	Limit int     `json:"limit,omitempty"`
+	Next  *string `json:"next"`
+	Prev  *string `json:"prev"`
+	Total *int64  `json:"total,omitempty"`
+}
+
+// Page responds with a page of items. Next and prev are the positions of the
+// neighbouring pages, which are empty if there is none: offsets from
+// Pagination.Offsets in offset paging, or positions that are turned into cursors
+// in cursor paging. A negative total is left out. The body becomes
+// {"items": [...], "page": {"limit", "next", "prev", "total"}}, or the items with the page
+// in the meta in envelope mode. The links to the neighbouring pages are sent in a Link header.
+func (r *Response) Page(items interface{}, next, prev string, total int64) *Response {
+	r.page = &page{
+		items: items,
+		next:  next,
+		prev:  prev,
+		total: total,
+	}
+	return r.Ok(items)
+}
+
+// finishPage builds the body and links of a page using the Pagination of the request
+func (s *JsonServer) finishPage(req *Request, res *Response) {
+	if res.page == nil || res.Err != nil {
+		return
+	}
+	p, ok := req.GetMiddlewareVar(Paging).(*Pagination)
+	if !ok {
+		p = &Pagination{}
+	}
+	meta := pageMeta{Limit: p.Limit}
+	if res.page.total >= 0 {
+		meta.Total = &res.page.total
+	}
+	var links []string
+	for _, link := range []struct {
+		rel      string
+		position string
+		token    **string
+	}{
+		{"next", res.page.next, &meta.Next},
+		{"prev", res.page.prev, &meta.Prev},
+	} {
+		if link.position == "" {
+			continue
+		}
+		token := link.position
+		if p.Mode == CursorPaging {
+			token = p.signer.Encode(link.position)
+		}
+		*link.token = &token
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, s.pageURL(req, p, token), link.rel))
+	}
+	if len(links) > 0 {
+		res.Writer.Header().Add(headerLink, strings.Join(links, ", "))
+	}
+	if s.envelope {
+		res.AddMeta("page", meta)
+		res.Body = res.page.items
+	} else {
+		res.Body = pageBody{Items: res.page.items, Page: meta}
+	}
+}
+
+// pageURL links to another page of the current route
+func (s *JsonServer) pageURL(req *Request, p *Pagination, token string) string {
+	path := req.URL().Path
+	if s.router != nil {
+		if route := s.router.Get(req.RouteName()); route != nil {
+			var pairs []string
+			for key, value := range mux.Vars(req.raw) {
+				pairs = append(pairs, key, value)
+			}
+			if u, err := route.URLPath(pairs...); err == nil {
+				path = u.Path
+			}
+		}
+	}
+	query := req.URL().Query()
+	if p.Limit > 0 {
+		query.Set(limitQuery, strconv.Itoa(p.Limit))
+	}
+	if p.Mode == CursorPaging {
+		query.Set(cursorQuery, token)
+	} else {
+		query.Set(offsetQuery, token)
+	}
+	return (&url.URL{Path: path, RawQuery: query.Encode()}).String()
+}
@@ -0,0 +1,123 @@
+package jsonserv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func pageRequest(query string) *Request {
+	return newRequest(httptest.NewRequest(http.MethodGet, "/items"+query, nil))
+}
+
+func TestRequest_Paginate_offset(t *testing.T) {
+	p, err := pageRequest("?limit=10&offset=30").Paginate(PageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Limit != 10 || p.Offset != 30 {
+		t.Fatalf("Unexpected pagination: %+v", p)
+	}
+	next, prev := p.Offsets(5, 35)
+	if next != "" || prev != "20" {
+		t.Fatalf("Unexpected offsets: %q %q", next, prev)
+	}
+	if next, _ = p.Offsets(10, -1); next != "40" {
+		t.Fatalf("Unexpected next offset of a full page: %q", next)
+	}
+	if next, _ = p.Offsets(9, -1); next != "" {
+		t.Fatalf("Unexpected next offset of the last page: %q", next)
+	}
+}
+
+func TestRequest_Paginate_defaults(t *testing.T) {
+	p, err := pageRequest("").Paginate(PageOptions{DefaultLimit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Limit != 5 || p.Offset != 0 {
+		t.Fatalf("Unexpected pagination: %+v", p)
+	}
+}
+
+func TestRequest_Paginate_invalid(t *testing.T) {
+	signer := NewCursorSigner([]byte("secret"))
+	forged := NewCursorSigner([]byte("other")).Encode("10")
+	cases := map[string]PageOptions{
+		"?limit=0":            {},
+		"?limit=101":          {},
+		"?limit=11":           {MaxLimit: 10},
+		"?limit=abc":          {},
+		"?offset=-1":          {},
+		"?cursor=" + forged:   {Mode: CursorPaging, Signer: signer},
+		"?cursor=MTA":         {Mode: CursorPaging, Signer: signer},
+		"?cursor=not+base64!": {Mode: CursorPaging},
+	}
+	for query, options := range cases {
+		_, err := pageRequest(query).Paginate(options)
+		if asHTTPError(err).Status != http.StatusBadRequest {
+			t.Fatalf("Unexpected error for %s: %v", query, err)
+		}
+	}
+}
+
+func TestCursorSigner_round_trip(t *testing.T) {
+	signer := NewCursorSigner([]byte("secret"))
+	p, err := pageRequest("?cursor=" + signer.Encode("id:42")).Paginate(PageOptions{Mode: CursorPaging, Signer: signer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Cursor != "id:42" {
+		t.Fatalf("Unexpected cursor: %q", p.Cursor)
+	}
+}
+
+func TestResponse_Page_offset(t *testing.T) {
+	s := New().AddRoute(http.MethodGet, "Items", "/lists/{list}/items", func(app interface{}, r *Request, out *Response) {
+		p, err := r.Paginate(PageOptions{})
+		if err != nil {
+			out.Error(err)
+			return
+		}
+		next, prev := p.Offsets(2, 100)
+		out.Page([]int{1, 2}, next, prev, 100)
+	})
+	w, body := serveJSON(t, s, http.MethodGet, "/lists/a/items?limit=2&offset=2&sort=name")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	expected := `</lists/a/items?limit=2&offset=4&sort=name>; rel="next", </lists/a/items?limit=2&offset=0&sort=name>; rel="prev"`
+	if w.Header().Get(headerLink) != expected {
+		t.Fatalf("Unexpected links: %s", w.Header().Get(headerLink))
+	}
+	meta := body["page"].(map[string]interface{})
+	if meta["next"] != "4" || meta["prev"] != "0" || meta["total"] != float64(100) || meta["limit"] != float64(2) {
+		t.Fatalf("Unexpected page: %v", meta)
+	}
+	if len(body["items"].([]interface{})) != 2 {
+		t.Fatalf("Unexpected items: %v", body["items"])
+	}
+}
+
+func TestResponse_Page_cursor(t *testing.T) {
+	signer := NewCursorSigner([]byte("secret"))
+	s := New().AddRoute(http.MethodGet, "Items", "/items", func(app interface{}, r *Request, out *Response) {
+		if _, err := r.Paginate(PageOptions{Mode: CursorPaging, Signer: signer}); err != nil {
+			out.Error(err)
+			return
+		}
+		out.Page([]int{1, 2}, "id:2", "", -1)
+	})
+	w, body := serveJSON(t, s, http.MethodGet, "/items")
+	next := signer.Encode("id:2")
+	if w.Header().Get(headerLink) != `</items?cursor=`+next+`&limit=20>; rel="next"` {
+		t.Fatalf("Unexpected links: %s", w.Header().Get(headerLink))
+	}
+	meta := body["page"].(map[string]interface{})
+	if meta["next"] != next || meta["prev"] != nil {
+		t.Fatalf("Unexpected page: %v", meta)
+	}
+	if _, ok := meta["total"]; ok {
+		t.Fatalf("Unexpected total: %v", meta)
+	}
+}
@@ -0,0 +1,440 @@
+package jsonserv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypeMergePatch = "application/merge-patch+json"
+	contentTypeJSONPatch  = "application/json-patch+json"
+)
+
+// ParsePatch applies the body to v as a JSON patch or a merge patch, depending on
+// the Content-Type of the request. Other types fail with a 415.
+func (r *Request) ParsePatch(v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header().Get(contentTypeHeader))
+	switch mediaType {
+	case contentTypeJSONPatch:
+		return r.ParseJSONPatch(v)
+	case contentTypeMergePatch, contentTypeJson:
+		return r.ParseMergePatch(v)
+	}
+	return NewHTTPError(http.StatusUnsupportedMediaType, "unsupported_media_type", "Patches must be "+contentTypeMergePatch+" or "+contentTypeJSONPatch)
+}
+
+// ParseMergePatch applies the JSON merge patch (RFC 7396) in the body to v, which holds the
+// current value of the resource. Malformed patches fail with a 400 and patches that don't
+// fit v with a 422.
+func (r *Request) ParseMergePatch(v interface{}) error {
+	patch, err := r.readBody()
+	if err != nil {
+		return err
+	}
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	patched, err := MergePatch(doc, patch)
+	if err != nil {
+		return err
+	}
+	return replaceValue(v, patched)
+}
+
+// ParseJSONPatch applies the JSON patch (RFC 6902) in the body to v, which holds the current
+// value of the resource. Malformed patches fail with a 400, and invalid or failing operations
+// with a 422 detailing the operation.
+func (r *Request) ParseJSONPatch(v interface{}) error {
+	body, err := r.readBody()
+	if err != nil {
+		return err
+	}
+	var patch JSONPatch
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return ErrBadRequest("Malformed JSON patch").Wrap(err)
+	}
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	patched, err := patch.Apply(doc)
+	if err != nil {
+		return err
+	}
+	return replaceValue(v, patched)
+}
+
+// replaceValue decodes the patched document into v, clearing it first so removed
+// members don't keep their old values
+func replaceValue(v interface{}, patched []byte) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cannot patch non-pointer %T", v)
+	}
+	// decode into a fresh value so a failed patch leaves v alone
+	fresh := reflect.New(rv.Elem().Type())
+	if err := json.Unmarshal(patched, fresh.Interface()); err != nil {
+		return ErrUnprocessable("Patched document is invalid").Wrap(err)
+	}
+	rv.Elem().Set(fresh.Elem())
+	return nil
+}
+
+// MergePatch applies a JSON merge patch (RFC 7396) to a document
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decodePatchValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decodePatchValue(patch)
+	if err != nil {
+		return nil, ErrBadRequest("Malformed merge patch").Wrap(err)
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergePatch(t[key], value)
+		}
+	}
+	return t
+}
+
+// JSONPatch is a list of JSON patch (RFC 6902) operations
+type JSONPatch []PatchOperation
+
+// PatchOperation is a single JSON patch operation. Path and From are nil when the
+// member is missing, which is different from "", the whole document.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply applies every operation to a document, failing with a 422 on the first
+// operation that is invalid or fails
+func (p JSONPatch) Apply(doc []byte) ([]byte, error) {
+	target, err := decodePatchValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range p {
+		if target, err = op.apply(target); err != nil {
+			return nil, ErrUnprocessable(fmt.Sprintf("Patch operation %d failed: %s", i, err.Error())).
+				WithDetails(map[string]interface{}{
+					"operation": i,
+					"op":        op.Op,
+					"path":      op.Path,
+					"reason":    err.Error(),
+				})
+		}
+	}
+	return json.Marshal(target)
+}
+
+func (op PatchOperation) apply(doc interface{}) (interface{}, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("missing path for %q", op.Op)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return pointerAdd(doc, path, value)
+		case "replace":
+			if doc, err = pointerRemove(doc, path); err != nil {
+				return nil, err
+			}
+			return pointerAdd(doc, path, value)
+		}
+		current, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !patchValuesEqual(current, value) {
+			return nil, fmt.Errorf("test failed at %q", *op.Path)
+		}
+		return doc, nil
+	case "remove":
+		return pointerRemove(doc, path)
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("missing from for %q", op.Op)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			return pointerAdd(doc, path, copyPatchValue(value))
+		}
+		if *op.Path != *op.From && strings.HasPrefix(*op.Path, *op.From+"/") {
+			return nil, fmt.Errorf("cannot move %q into itself", *op.From)
+		}
+		if doc, err = pointerRemove(doc, from); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+func (op PatchOperation) value() (interface{}, error) {
+	if len(op.Value) == 0 {
+		return nil, fmt.Errorf("missing value for %q", op.Op)
+	}
+	return decodePatchValue(op.Value)
+}
+
+func decodePatchValue(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch c := doc.(type) {
+		case map[string]interface{}:
+			value, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("%q does not exist", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerUpdate replaces the container at the parent of the path with the result of update
+func pointerUpdate(doc interface{}, path []string, update func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(doc, path[0])
+	}
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		child, ok := c[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%q does not exist", path[0])
+		}
+		child, err := pointerUpdate(child, path[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		c[path[0]] = child
+		return c, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		if c[i], err = pointerUpdate(c[i], path[1:], update); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("%q does not exist", path[0])
+}
+
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[token] = value
+			return c, nil
+		case []interface{}:
+			if token == "-" {
+				return append(c, value), nil
+			}
+			i, err := arrayIndex(token, len(c))
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("cannot add %q to a value", token)
+	})
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return pointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("%q does not exist", token)
+			}
+			delete(c, token)
+			return c, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%q does not exist", token)
+	})
+}
+
+// arrayIndex parses an array index no greater than max
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid index %q", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("index %d out of bounds", i)
+	}
+	return i, nil
+}
+
+func copyPatchValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c[key] = copyPatchValue(value)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = copyPatchValue(value)
+		}
+		return c
+	}
+	return v
+}
+
+// patchValuesEqual compares decoded values, comparing numbers by value
+func patchValuesEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		n, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		return canonicalNumber(a) == canonicalNumber(n)
+	case map[string]interface{}:
+		m, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(m) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := m[key]
+			if !ok || !patchValuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		s, ok := b.([]interface{})
+		if !ok || len(a) != len(s) {
+			return false
+		}
+		for i := range a {
+			if !patchValuesEqual(a[i], s[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// canonicalNumber writes a JSON number as its significant digits and exponent, so numbers
+// compare by value exactly, without the rounding of float64
+func canonicalNumber(n json.Number) string {
+	s := n.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(strings.TrimPrefix(s[i+1:], "+"))
+		if err != nil {
+			return n.String()
+		}
+		s, exp = s[:i], e
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		exp -= len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+	s = strings.TrimLeft(s, "0")
+	if s == "" {
+		return "0"
+	}
+	trimmed := strings.TrimRight(s, "0")
+	exp += len(s) - len(trimmed)
+	return sign + trimmed + "e" + strconv.Itoa(exp)
+}
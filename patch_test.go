@@ -0,0 +1,162 @@
+package jsonserv
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type patchUser struct {
+	Name  string   `json:"name"`
+	Email *string  `json:"email"`
+	Tags  []string `json:"tags"`
+	Age   int      `json:"age"`
+}
+
+func patchRequest(contentType, body string) *Request {
+	r := mockRequest()
+	r.Method = http.MethodPatch
+	r.Body = ioutil.NopCloser(strings.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set(contentTypeHeader, contentType)
+	return newRequest(r)
+}
+
+func TestMergePatch(t *testing.T) {
+	// from RFC 7396
+	doc := `{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"This will be unchanged"}`
+	patch := `{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`
+	expected := `{"author":{"givenName":"John"},"content":"This will be unchanged","phoneNumber":"+01-123-456-7890","tags":["example"],"title":"Hello!"}`
+
+	result, err := MergePatch([]byte(doc), []byte(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != expected {
+		t.Fatalf("Unexpected result: %s", result)
+	}
+}
+
+func TestRequest_ParseMergePatch(t *testing.T) {
+	email := "old@example.com"
+	user := &patchUser{Name: "old", Email: &email, Tags: []string{"a"}, Age: 30}
+	req := patchRequest(contentTypeMergePatch, `{"name":"new","email":null}`)
+
+	if err := req.ParsePatch(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "new" || user.Email != nil || user.Age != 30 || len(user.Tags) != 1 {
+		t.Fatalf("Unexpected user: %+v", user)
+	}
+}
+
+func TestRequest_ParseMergePatch_invalid(t *testing.T) {
+	user := &patchUser{Name: "old", Age: 30}
+	err := patchRequest(contentTypeMergePatch, `{"age":"thirty"}`).ParseMergePatch(user)
+	if asHTTPError(err).Status != http.StatusUnprocessableEntity {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.Name != "old" || user.Age != 30 {
+		t.Fatalf("Failed patch changed the user: %+v", user)
+	}
+	err = patchRequest(contentTypeMergePatch, `{"age":`).ParseMergePatch(user)
+	if asHTTPError(err).Status != http.StatusBadRequest {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestJSONPatch_Apply(t *testing.T) {
+	doc := `{"a":{"b":[1,2,3]},"c":"d"}`
+	patch := patchRequest(contentTypeJSONPatch, `[
+		{"op":"test","path":"/a/b/0","value":1.0},
+		{"op":"add","path":"/a/b/1","value":"x"},
+		{"op":"add","path":"/a/b/-","value":null},
+		{"op":"remove","path":"/a/b/0"},
+		{"op":"replace","path":"/c","value":{"e":"f"}},
+		{"op":"move","from":"/c/e","path":"/g~1h"},
+		{"op":"copy","from":"/a/b","path":"/i"}
+	]`)
+	var ops JSONPatch
+	if err := patch.ParseBody(&ops); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ops.Apply([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"a":{"b":["x",2,3,null]},"c":{},"g/h":"f","i":["x",2,3,null]}`
+	if string(result) != expected {
+		t.Fatalf("Unexpected result: %s", result)
+	}
+}
+
+func TestJSONPatch_Apply_errors(t *testing.T) {
+	cases := []string{
+		`[{"op":"test","path":"/a","value":2}]`,
+		`[{"op":"remove","path":"/missing"}]`,
+		`[{"op":"add","path":"/list/5","value":2}]`,
+		`[{"op":"add","path":"/list/01","value":2}]`,
+		`[{"op":"replace","path":"/a"}]`,
+		`[{"op":"move","from":"/list","path":"/list/0"}]`,
+		`[{"op":"unknown","path":"/a"}]`,
+		`[{"op":"add","path":"a","value":1}]`,
+		`[{"op":"remove"}]`,
+		`[{"op":"add","value":1}]`,
+		`[{"op":"copy","path":"/c"}]`,
+		`[{"op":"move","path":"/c"}]`,
+	}
+	for _, c := range cases {
+		var ops JSONPatch
+		if err := patchRequest(contentTypeJSONPatch, c).ParseBody(&ops); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ops.Apply([]byte(`{"a":1,"list":[1]}`))
+		httpErr := asHTTPError(err)
+		if httpErr.Status != http.StatusUnprocessableEntity {
+			t.Fatalf("Unexpected error for %s: %v", c, err)
+		}
+		if httpErr.Details.(map[string]interface{})["operation"] != 0 {
+			t.Fatalf("Unexpected details for %s: %v", c, httpErr.Details)
+		}
+	}
+}
+
+func TestJSONPatch_Apply_test_numbers(t *testing.T) {
+	doc := []byte(`{"big":9007199254740993,"n":100}`)
+	cases := map[string]bool{
+		`[{"op":"test","path":"/big","value":9007199254740993}]`: true,
+		`[{"op":"test","path":"/big","value":9007199254740992}]`: false,
+		`[{"op":"test","path":"/n","value":1e2}]`:                true,
+		`[{"op":"test","path":"/n","value":100.00}]`:             true,
+		`[{"op":"test","path":"/n","value":-100}]`:               false,
+	}
+	for c, ok := range cases {
+		var ops JSONPatch
+		if err := patchRequest(contentTypeJSONPatch, c).ParseBody(&ops); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ops.Apply(doc); (err == nil) != ok {
+			t.Fatalf("Unexpected result for %s: %v", c, err)
+		}
+	}
+}
+
+func TestRequest_ParseJSONPatch(t *testing.T) {
+	user := &patchUser{Name: "old", Tags: []string{"a"}}
+	req := patchRequest(contentTypeJSONPatch, `[{"op":"add","path":"/tags/-","value":"b"},{"op":"remove","path":"/name"}]`)
+
+	if err := req.ParsePatch(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "" || len(user.Tags) != 2 || user.Tags[1] != "b" {
+		t.Fatalf("Unexpected user: %+v", user)
+	}
+}
+
+func TestRequest_ParsePatch_unsupported(t *testing.T) {
+	err := patchRequest("text/plain", `{}`).ParsePatch(&patchUser{})
+	if asHTTPError(err).Status != http.StatusUnsupportedMediaType {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package jsonserv
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PreconditionRequired    = "precondition_required"
+	headerIfMatch           = "If-Match"
+	headerIfUnmodifiedSince = "If-Unmodified-Since"
+)
+
+// NewRequirePreconditionMiddleware creates a middleware that makes CheckPreconditions
+// reject PUT, PATCH and DELETE requests without If-Match or If-Unmodified-Since with a 428
+func NewRequirePreconditionMiddleware() Middleware {
+	return NewStaticValueMiddleware(PreconditionRequired, true)
+}
+
+// VersionETag makes an entity tag from the version number of a resource
+func VersionETag(version int64) string {
+	return quoteETag(strconv.FormatInt(version, 10))
+}
+
+// CheckPreconditions compares If-Match and If-Unmodified-Since with the current version of
+// the resource before it is changed. Exists reports if the resource exists, which is all
+// "If-Match: *" checks, and either validator may be empty. When the request is out of date
+// the response fails with a 412, or a 428 when a precondition is required but missing,
+// and false is returned so the view can stop.
+func (r *Request) CheckPreconditions(res *Response, exists bool, etag string, lastModified time.Time) bool {
+	if match := r.Header().Get(headerIfMatch); match != "" {
+		matches := strings.TrimSpace(match) == "*" || (etag != "" && etagListMatches(match, quoteETag(etag), false))
+		if !exists || !matches {
+			res.Error(NewHTTPError(http.StatusPreconditionFailed, "precondition_failed", "The resource has been modified"))
+			return false
+		}
+		return true
+	}
+	if since := r.Header().Get(headerIfUnmodifiedSince); since != "" {
+		t, err := http.ParseTime(since)
+		if err == nil && !lastModified.IsZero() && lastModified.Truncate(time.Second).After(t) {
+			res.Error(NewHTTPError(http.StatusPreconditionFailed, "precondition_failed", "The resource has been modified"))
+			return false
+		}
+		return true
+	}
+	if r.requiresPrecondition() {
+		res.Error(NewHTTPError(http.StatusPreconditionRequired, "precondition_required", "If-Match or If-Unmodified-Since is required"))
+		return false
+	}
+	return true
+}
+
+func (r *Request) requiresPrecondition() bool {
+	switch r.Method() {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return r.GetOptionalMiddlewareVar(PreconditionRequired, false).(bool)
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package jsonserv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func preconditionRequest(method string, headers map[string]string) *Request {
+	r := mockRequest()
+	r.Method = method
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+	return newRequest(r)
+}
+
+func TestRequest_CheckPreconditions_IfMatch(t *testing.T) {
+	cases := []struct {
+		match string
+		ok    bool
+	}{
+		{`"3"`, true},
+		{`"2", "3"`, true},
+		{`*`, true},
+		{`"2"`, false},
+		{`"3-gzip"`, true},
+		{`W/"3"`, false},
+	}
+	for _, c := range cases {
+		req := preconditionRequest(http.MethodPut, map[string]string{headerIfMatch: c.match})
+		res := newResponse(mockWriter())
+		if req.CheckPreconditions(res, true, VersionETag(3), time.Time{}) != c.ok {
+			t.Fatalf("Unexpected result for %s", c.match)
+		}
+		if !c.ok && res.Code != http.StatusPreconditionFailed {
+			t.Fatalf("Unexpected code for %s: %d", c.match, res.Code)
+		}
+	}
+}
+
+func TestRequest_CheckPreconditions_IfMatch_exists(t *testing.T) {
+	req := preconditionRequest(http.MethodPut, map[string]string{headerIfMatch: "*"})
+	if !req.CheckPreconditions(newResponse(mockWriter()), true, "", time.Time{}) {
+		t.Fatal("Existing resource without a tag rejected")
+	}
+	res := newResponse(mockWriter())
+	if req.CheckPreconditions(res, false, "", time.Time{}) {
+		t.Fatal("Missing resource accepted")
+	}
+	if res.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Unexpected code: %d", res.Code)
+	}
+}
+
+func TestRequest_CheckPreconditions_IfUnmodifiedSince(t *testing.T) {
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	req := preconditionRequest(http.MethodDelete, map[string]string{headerIfUnmodifiedSince: modified.Format(http.TimeFormat)})
+	if !req.CheckPreconditions(newResponse(mockWriter()), true, "", modified) {
+		t.Fatal("Unmodified resource rejected")
+	}
+
+	res := newResponse(mockWriter())
+	if req.CheckPreconditions(res, true, "", modified.Add(time.Second)) {
+		t.Fatal("Modified resource accepted")
+	}
+	if res.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Unexpected code: %d", res.Code)
+	}
+}
+
+func TestRequest_CheckPreconditions_required(t *testing.T) {
+	req := preconditionRequest(http.MethodPatch, nil)
+	if !req.CheckPreconditions(newResponse(mockWriter()), true, `"1"`, time.Time{}) {
+		t.Fatal("Preconditions are optional by default")
+	}
+
+	req.SetMiddlewareVar(PreconditionRequired, true)
+	res := newResponse(mockWriter())
+	if req.CheckPreconditions(res, true, `"1"`, time.Time{}) {
+		t.Fatal("Missing precondition accepted")
+	}
+	if res.Code != http.StatusPreconditionRequired {
+		t.Fatalf("Unexpected code: %d", res.Code)
+	}
+
+	req = preconditionRequest(http.MethodGet, nil)
+	req.SetMiddlewareVar(PreconditionRequired, true)
+	if !req.CheckPreconditions(newResponse(mockWriter()), true, `"1"`, time.Time{}) {
+		t.Fatal("Safe methods don't require preconditions")
+	}
+}
+
+func TestRequest_CheckPreconditions_compressed_etag(t *testing.T) {
+	view := func(app interface{}, r *Request, out *Response) {
+		if !r.CheckPreconditions(out, true, VersionETag(3), time.Time{}) {
+			return
+		}
+		out.ETag = VersionETag(3)
+		out.Ok(map[string]string{"value": strings.Repeat("large ", 500)})
+	}
+	s := New().
+		AddMiddleware(NewGzipMiddleware()).
+		AddRoute(http.MethodGet, "Get", "/", view).
+		AddRoute(http.MethodPut, "Put", "/", view)
+	router := s.createRouter()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(headerAcceptEncoding, EncodingGzip)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	etag := w.Header().Get(headerETag)
+	if w.Header().Get(headerContentEncoding) != EncodingGzip || etag != `"3-gzip"` {
+		t.Fatalf("Unexpected headers: %v", w.Header())
+	}
+
+	r = httptest.NewRequest(http.MethodPut, "/", nil)
+	r.Header.Set(headerIfMatch, etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package jsonserv
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	contentTypeProblemJson = "application/problem+json"
+	problemTypeBlank       = "about:blank"
+)
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	// Extensions are additional members serialized alongside the standard ones
+	Extensions map[string]interface{}
+}
+
+// MarshalJSON flattens the extension members into the problem object
+func (p Problem) MarshalJSON() ([]byte, error) {
+	body := make(map[string]interface{}, len(p.Extensions)+5)
+	for key, value := range p.Extensions {
+		body[key] = value
+	}
+	body["type"] = p.Type
+	body["title"] = p.Title
+	body["status"] = p.Status
+	if p.Detail != "" {
+		body["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		body["instance"] = p.Instance
+	}
+	return json.Marshal(body)
+}
+
+// newProblem describes an error as a problem. The members of errorBody become its
+// detail and extensions, so both formats show the same information.
+func newProblem(req *Request, err error) Problem {
+	httpErr := asHTTPError(err)
+	problem := Problem{
+		Type:       httpErr.Type,
+		Title:      http.StatusText(httpErr.Status),
+		Status:     httpErr.Status,
+		Instance:   req.URL().Path,
+		Extensions: errorBody(req, err),
+	}
+	if problem.Type == "" {
+		problem.Type = problemTypeBlank
+	}
+	if detail, ok := problem.Extensions["error"].(string); ok {
+		problem.Detail = detail
+		delete(problem.Extensions, "error")
+	}
+	return problem
+}
@@ -0,0 +1,91 @@
+package jsonserv
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestProblem_MarshalJSON(t *testing.T) {
+	problem := Problem{
+		Type:       problemTypeBlank,
+		Title:      "Not Found",
+		Status:     http.StatusNotFound,
+		Extensions: map[string]interface{}{"code": "not_found", "status": "ignored"},
+	}
+	b, err := json.Marshal(problem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"code":"not_found","status":404,"title":"Not Found","type":"about:blank"}` {
+		t.Fatalf("Unexpected json: %s", b)
+	}
+}
+
+func TestProblemJSON_NotFound(t *testing.T) {
+	s := New().SetProblemJSON(true)
+	w, body := serveJSON(t, s, http.MethodGet, "/missing")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if w.Header().Get(contentTypeHeader) != contentTypeProblemJson {
+		t.Fatalf("Unexpected content type: %s", w.Header().Get(contentTypeHeader))
+	}
+	if body["status"] != float64(http.StatusNotFound) || body["instance"] != "/missing" || body["code"] != "not_found" {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
+
+func TestNotFound_plain(t *testing.T) {
+	w, body := serveJSON(t, New(), http.MethodGet, "/missing")
+	if w.Code != http.StatusNotFound || len(body) != 0 {
+		t.Fatalf("Unexpected response: %d %v", w.Code, body)
+	}
+}
+
+func TestProblemJSON_MethodNotAllowed(t *testing.T) {
+	s := New().SetProblemJSON(true).
+		AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {})
+	w, body := serveJSON(t, s, http.MethodPost, "/")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if body["title"] != "Method Not Allowed" {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
+
+func TestProblemJSON_Panic(t *testing.T) {
+	s := New().SetProblemJSON(true).
+		AddRoute(http.MethodGet, "Panic", "/", func(app interface{}, r *Request, out *Response) {
+			panic("boom")
+		})
+	w, body := serveJSON(t, s, http.MethodGet, "/")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if _, ok := body["detail"]; ok {
+		t.Fatalf("Internal error shown: %v", body)
+	}
+}
+
+func TestProblemJSON_Validation(t *testing.T) {
+	s := New().SetProblemJSON(true).
+		AddMiddleware(NewDebugFlagMiddleware(true)).
+		AddRoute(http.MethodGet, "Invalid", "/", func(app interface{}, r *Request, out *Response) {
+			err := ErrUnprocessable("Invalid user").WithDetails(map[string]string{"name": "required"})
+			err.Type = "https://example.com/problems/invalid-user"
+			out.Error(err.Wrap(errors.New("cause")))
+		})
+	w, body := serveJSON(t, s, http.MethodGet, "/")
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if body["type"] != "https://example.com/problems/invalid-user" || body["detail"] != "Invalid user" {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+	if body["details"] == nil || body["cause"] != "cause" {
+		t.Fatalf("Missing extensions: %v", body)
+	}
+}
@@ -0,0 +1,226 @@
+package jsonserv
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	filterQuery = "filter"
+	sortQuery   = "sort"
+	dateLayout  = "2006-01-02"
+)
+
+// FieldType is the type values of a filtered field are parsed as
+type FieldType int
+
+const (
+	StringField FieldType = iota
+	IntField
+	FloatField
+	BoolField
+	// TimeField values are RFC 3339 times or dates
+	TimeField
+)
+
+// Operator compares a field with a filter value
+type Operator string
+
+const (
+	OpEq       Operator = "eq"
+	OpNe       Operator = "ne"
+	OpGt       Operator = "gt"
+	OpGte      Operator = "gte"
+	OpLt       Operator = "lt"
+	OpLte      Operator = "lte"
+	OpIn       Operator = "in"
+	OpContains Operator = "contains"
+)
+
+// FilterField declares a field that can be filtered on
+type FilterField struct {
+	Type FieldType
+	// Operators are the operators allowed on the field, only OpEq if empty
+	Operators []Operator
+}
+
+// QuerySpec is the whitelist of fields a list route can filter and sort on
+type QuerySpec struct {
+	Filters map[string]FilterField
+	Sort    []string
+}
+
+// Query is a parsed ?filter[...]= and ?sort= query
+type Query struct {
+	Filters []Filter
+	Sort    []SortField
+}
+
+// Filter compares a field with a value. Values are typed by the field: string, int64,
+// float64, bool or time.Time, and a []interface{} of those for OpIn.
+type Filter struct {
+	Field string
+	Op    Operator
+	Value interface{}
+}
+
+// SortField orders results by a field
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ParseQuery parses ?filter[field]=value, ?filter[field][op]=value and ?sort=-field,other
+// against a whitelist. Unknown fields, operators and malformed values fail with a 400
+// detailing every problem.
+func (r *Request) ParseQuery(spec QuerySpec) (*Query, error) {
+	query := r.URL().Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	q := &Query{}
+	var problems []map[string]string
+	fail := func(param, reason string) {
+		problems = append(problems, map[string]string{"param": param, "reason": reason})
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, filterQuery+"[") {
+			continue
+		}
+		field, op, ok := parseFilterKey(key)
+		if !ok {
+			fail(key, "malformed filter")
+			continue
+		}
+		declared, ok := spec.Filters[field]
+		if !ok {
+			fail(key, fmt.Sprintf("cannot filter on %q", field))
+			continue
+		}
+		if !declared.allows(op) {
+			fail(key, fmt.Sprintf("operator %q is not allowed on %q", op, field))
+			continue
+		}
+		for _, raw := range query[key] {
+			value, err := declared.parse(op, raw)
+			if err != nil {
+				fail(key, err.Error())
+				continue
+			}
+			q.Filters = append(q.Filters, Filter{Field: field, Op: op, Value: value})
+		}
+	}
+	if value := query.Get(sortQuery); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			sortField := SortField{Field: strings.TrimSpace(field)}
+			if strings.HasPrefix(sortField.Field, "-") {
+				sortField.Field, sortField.Desc = sortField.Field[1:], true
+			}
+			if !containsString(spec.Sort, sortField.Field) {
+				fail(sortQuery, fmt.Sprintf("cannot sort on %q", sortField.Field))
+				continue
+			}
+			q.Sort = append(q.Sort, sortField)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, ErrBadRequest("Invalid query").WithDetails(problems)
+	}
+	return q, nil
+}
+
+// parseFilterKey splits filter[field] and filter[field][op]
+func parseFilterKey(key string) (string, Operator, bool) {
+	rest := strings.TrimPrefix(key, filterQuery)
+	var parts []string
+	for len(rest) > 0 {
+		end := strings.IndexByte(rest, ']')
+		if rest[0] != '[' || end < 2 {
+			return "", "", false
+		}
+		parts = append(parts, rest[1:end])
+		rest = rest[end+1:]
+	}
+	switch len(parts) {
+	case 1:
+		return parts[0], OpEq, true
+	case 2:
+		return parts[0], Operator(parts[1]), true
+	}
+	return "", "", false
+}
+
+func (f FilterField) allows(op Operator) bool {
+	if len(f.Operators) == 0 {
+		return op == OpEq
+	}
+	for _, allowed := range f.Operators {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (f FilterField) parse(op Operator, raw string) (interface{}, error) {
+	if op != OpIn {
+		return f.parseValue(raw)
+	}
+	var values []interface{}
+	for _, item := range strings.Split(raw, ",") {
+		value, err := f.parseValue(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (f FilterField) parseValue(raw string) (interface{}, error) {
+	switch f.Type {
+	case IntField:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		return value, nil
+	case FloatField:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", raw)
+		}
+		return value, nil
+	case BoolField:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return value, nil
+	case TimeField:
+		if value, err := time.Parse(time.RFC3339, raw); err == nil {
+			return value, nil
+		}
+		value, err := time.Parse(dateLayout, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a time", raw)
+		}
+		return value, nil
+	}
+	return raw, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package jsonserv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var querySpec = QuerySpec{
+	Filters: map[string]FilterField{
+		"status":     {Type: StringField, Operators: []Operator{OpEq, OpIn}},
+		"created_at": {Type: TimeField, Operators: []Operator{OpGte, OpLt}},
+		"score":      {Type: IntField, Operators: []Operator{OpGt}},
+		"active":     {Type: BoolField},
+	},
+	Sort: []string{"created_at", "name"},
+}
+
+func queryRequest(values url.Values) *Request {
+	return newRequest(httptest.NewRequest(http.MethodGet, "/items?"+values.Encode(), nil))
+}
+
+func TestRequest_ParseQuery(t *testing.T) {
+	req := queryRequest(url.Values{
+		"filter[status]":          {"active"},
+		"filter[status][in]":      {"a,b"},
+		"filter[created_at][gte]": {"2020-01-02"},
+		"filter[created_at][lt]":  {"2020-02-01T10:00:00Z"},
+		"filter[score][gt]":       {"10"},
+		"filter[active]":          {"true"},
+		"sort":                    {"-created_at,name"},
+		"limit":                   {"10"},
+	})
+	q, err := req.ParseQuery(querySpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Query{
+		Filters: []Filter{
+			{Field: "active", Op: OpEq, Value: true},
+			{Field: "created_at", Op: OpGte, Value: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+			{Field: "created_at", Op: OpLt, Value: time.Date(2020, 2, 1, 10, 0, 0, 0, time.UTC)},
+			{Field: "score", Op: OpGt, Value: int64(10)},
+			{Field: "status", Op: OpEq, Value: "active"},
+			{Field: "status", Op: OpIn, Value: []interface{}{"a", "b"}},
+		},
+		Sort: []SortField{{Field: "created_at", Desc: true}, {Field: "name"}},
+	}
+	if !reflect.DeepEqual(q, expected) {
+		t.Fatalf("Unexpected query: %+v", q)
+	}
+}
+
+func TestRequest_ParseQuery_invalid(t *testing.T) {
+	req := queryRequest(url.Values{
+		"filter[unknown]":        {"x"},
+		"filter[status][gt]":     {"x"},
+		"filter[score][gt]":      {"ten"},
+		"filter[created_at][lt]": {"yesterday"},
+		"filter[status":          {"x"},
+		"filter[a][b][c]":        {"x"},
+		"sort":                   {"score"},
+	})
+	_, err := req.ParseQuery(querySpec)
+	httpErr := asHTTPError(err)
+	if httpErr.Status != http.StatusBadRequest {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if problems := httpErr.Details.([]map[string]string); len(problems) != 7 {
+		t.Fatalf("Unexpected problems: %v", problems)
+	}
+}
@@ -0,0 +1,201 @@
+package jsonserv
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	headerRetryAfter         = "Retry-After"
+	headerRateLimitLimit     = "RateLimit-Limit"
+	headerRateLimitRemaining = "RateLimit-Remaining"
+	headerRateLimitReset     = "RateLimit-Reset"
+	// rateLimitSweepInterval is how often the memory store evicts idle keys
+	rateLimitSweepInterval = time.Minute
+)
+
+// RateLimit allows Requests per Window, in bursts of up to Burst requests
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+	// Burst is the size of the token bucket, Requests if 0
+	Burst int
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// interval is the time it takes to refill one token
+func (l RateLimit) interval() time.Duration {
+	return l.Window / time.Duration(l.Requests)
+}
+
+// RateLimitResult is the state of a key's bucket after taking a token
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is when the next token is available if the request was not allowed
+	RetryAfter time.Duration
+	// Reset is when the bucket is full again
+	Reset time.Duration
+}
+
+// RateLimitStore keeps the token buckets of rate limited keys
+type RateLimitStore interface {
+	Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimitKeyFunc is the key a request is limited by. Requests with an empty key are not limited.
+type RateLimitKeyFunc func(req *Request) string
+
+// KeyByIP limits each client address
+func KeyByIP(req *Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr())
+	if err != nil {
+		return req.RemoteAddr()
+	}
+	return host
+}
+
+// KeyByHeader limits each value of a header, such as an API key
+func KeyByHeader(header string) RateLimitKeyFunc {
+	return func(req *Request) string {
+		return req.Header().Get(header)
+	}
+}
+
+// KeyByRoute limits each route as a whole
+func KeyByRoute(req *Request) string {
+	return req.RouteName()
+}
+
+// RateLimitOptions configure the rate limiting middleware
+type RateLimitOptions struct {
+	// Limit applies to every route without a limit of its own
+	Limit RateLimit
+	// Routes are limits of routes by name, counted separately from the other routes
+	Routes map[string]RateLimit
+	// Key is what requests are limited by, KeyByIP if nil
+	Key RateLimitKeyFunc
+	// Store keeps the buckets, in memory if nil
+	Store RateLimitStore
+}
+
+type rateLimitMiddleware struct {
+	options RateLimitOptions
+	now     func() time.Time
+}
+
+// NewRateLimitMiddleware creates a middleware that limits requests with token buckets and
+// halts requests over the limit with a 429. Responses get RateLimit-* headers, and 429s a
+// Retry-After header. Requests are allowed if the store fails.
+func NewRateLimitMiddleware(options RateLimitOptions) Middleware {
+	if options.Key == nil {
+		options.Key = KeyByIP
+	}
+	if options.Store == nil {
+		options.Store = NewMemoryRateLimitStore()
+	}
+	return &rateLimitMiddleware{options: options, now: time.Now}
+}
+
+func (m *rateLimitMiddleware) Ingress(app interface{}, req *Request, res *Response) {
+	key := m.options.Key(req)
+	if key == "" {
+		return
+	}
+	limit := m.options.Limit
+	if routeLimit, ok := m.options.Routes[req.RouteName()]; ok {
+		limit = routeLimit
+		key = req.RouteName() + "\x00" + key
+	}
+	if limit.Requests <= 0 || limit.Window <= 0 {
+		return
+	}
+	result, err := m.options.Store.Take(key, limit, m.now())
+	if err != nil {
+		req.Log(LevelError, "Error rate limiting", Field{Key: "error", Value: err})
+		return
+	}
+	res.AddHeader(headerRateLimitLimit, strconv.Itoa(limit.Requests))
+	res.AddHeader(headerRateLimitRemaining, strconv.Itoa(result.Remaining))
+	res.AddHeader(headerRateLimitReset, seconds(result.Reset))
+	if !result.Allowed {
+		res.AddHeader(headerRetryAfter, seconds(result.RetryAfter))
+		res.Error(NewHTTPError(http.StatusTooManyRequests, "rate_limited", "Too many requests")).Halt()
+	}
+}
+
+func (m *rateLimitMiddleware) Egress(app interface{}, req *Request, res *Response) {
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// memoryRateLimitStore keeps buckets in memory
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	// updated is when tokens was last refilled
+	updated time.Time
+	// full is when the bucket is full again, after which it can be evicted
+	full time.Time
+}
+
+// NewMemoryRateLimitStore creates a store that keeps buckets in memory. Keys that
+// have been idle long enough for their bucket to refill are evicted.
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (s *memoryRateLimitStore) Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= rateLimitSweepInterval {
+		s.sweep(now)
+	}
+	burst := float64(limit.burst())
+	interval := limit.interval()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+float64(now.Sub(b.updated))/float64(interval))
+	b.updated = now
+
+	result := RateLimitResult{Allowed: b.tokens >= 1}
+	if result.Allowed {
+		b.tokens--
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(interval))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((burst - b.tokens) * float64(interval))
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+func (s *memoryRateLimitStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
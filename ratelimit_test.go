@@ -0,0 +1,93 @@
+package jsonserv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limit := RateLimit{Requests: 2, Window: time.Second}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, allowed := range []bool{true, true, false} {
+		result, _ := store.Take("a", limit, now)
+		if result.Allowed != allowed {
+			t.Fatalf("Request %d: unexpected result %+v", i, result)
+		}
+	}
+	result, _ := store.Take("a", limit, now)
+	if result.RetryAfter != 500*time.Millisecond || result.Reset != time.Second {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if result, _ := store.Take("a", limit, now.Add(500*time.Millisecond)); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("Unexpected refill: %+v", result)
+	}
+	if result, _ := store.Take("b", limit, now); !result.Allowed || result.Remaining != 1 {
+		t.Fatalf("Keys not separate: %+v", result)
+	}
+}
+
+func TestMemoryRateLimitStore_evicts_idle_keys(t *testing.T) {
+	store := NewMemoryRateLimitStore().(*memoryRateLimitStore)
+	limit := RateLimit{Requests: 10, Window: time.Second}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.Take("idle", limit, now)
+	store.Take("busy", limit, now.Add(2*time.Minute))
+	if _, ok := store.buckets["idle"]; ok || len(store.buckets) != 1 {
+		t.Fatalf("Idle key not evicted: %v", store.buckets)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	var viewed, egressed, inner int
+	s := New().
+		AddMiddleware(egressFunc(func(res *Response) { egressed++ })).
+		AddMiddleware(NewRateLimitMiddleware(RateLimitOptions{
+			Limit:  RateLimit{Requests: 1, Window: time.Minute},
+			Routes: map[string]RateLimit{"Search": {Requests: 2, Window: time.Minute}},
+			Key:    KeyByHeader("X-API-Key"),
+		})).
+		AddMiddleware(egressFunc(func(res *Response) { inner++ })).
+		AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {
+			viewed++
+			out.Ok(nil)
+		}).
+		AddRoute(http.MethodGet, "Search", "/search", func(app interface{}, r *Request, out *Response) {
+			out.Ok(nil)
+		})
+	router := s.createRouter()
+	serve := func(path, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve("/", "a"); w.Code != http.StatusOK || w.Header().Get(headerRateLimitRemaining) != "0" {
+		t.Fatalf("Unexpected response: %d %v", w.Code, w.Header())
+	}
+	w := serve("/", "a")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(headerRetryAfter) != "60" {
+		t.Fatalf("Unexpected response: %d %v", w.Code, w.Header())
+	}
+	if viewed != 1 || egressed != 2 || inner != 1 {
+		t.Fatalf("Unexpected chain: viewed %d, egressed %d and %d", viewed, egressed, inner)
+	}
+	if w := serve("/", "b"); w.Code != http.StatusOK {
+		t.Fatalf("Keys not separate: %d", w.Code)
+	}
+	if w := serve("/search", "a"); w.Code != http.StatusOK || w.Header().Get(headerRateLimitLimit) != "2" {
+		t.Fatalf("Route limit not used: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestKeyByIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	if key := KeyByIP(newRequest(r)); key != "10.0.0.1" {
+		t.Fatalf("Unexpected key: %s", key)
+	}
+}
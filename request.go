@@ -1,20 +1,28 @@
 package jsonserv
 
 import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
 
 type Request struct {
 	raw  *http.Request
+	name string
 	vars map[string]interface{}
+	// logger, logOptions and jsonOptions are those of the server
+	logger      Logger
+	logOptions  LogOptions
+	jsonOptions JSONOptions
 }
 
 func newRequest(r *http.Request) *Request {
@@ -36,6 +44,21 @@ func (r *Request) Header() http.Header {
 	return r.raw.Header
 }
 
+// Context is cancelled when the client goes away
+func (r *Request) Context() context.Context {
+	return r.raw.Context()
+}
+
+// RemoteAddr is the network address of the client
+func (r *Request) RemoteAddr() string {
+	return r.raw.RemoteAddr
+}
+
+// RouteName is the name of the route serving the request
+func (r *Request) RouteName() string {
+	return r.name
+}
+
 func (r *Request) GetMiddlewareVar(key string) interface{} {
 	if r.vars == nil {
 		return nil
@@ -82,25 +105,71 @@ func (r *Request) GetPathVar(key string, fallback string) string {
 	}
 }
 
+// ParseBody decodes the JSON body into v. Bodies larger than the MaxBodySize are rejected
+// with a 413 and malformed bodies with a 400.
 func (r *Request) ParseBody(v interface{}) error {
+	body, err := r.readBody()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return ErrBadRequest("Malformed request body").Wrap(err)
+	}
+	return nil
+}
+
+// readBody reads the whole body, up to the MaxBodySize. Gzip and deflate bodies are
+// decompressed, and the MaxBodySize applies to the decompressed body.
+func (r *Request) readBody() ([]byte, error) {
+	defer r.raw.Body.Close()
 	maxRequestSize := r.GetOptionalMiddlewareVar(MaxBodySize, int64(0)).(int64)
-	var reader io.Reader
-	if maxRequestSize == 0 {
-		reader = r.raw.Body
-	} else if r.raw.ContentLength > maxRequestSize {
-		return errors.New("Request body too large")
-	} else {
-		reader = io.LimitReader(r.raw.Body, maxRequestSize)
+	encoding := strings.ToLower(strings.TrimSpace(r.raw.Header.Get(headerContentEncoding)))
+	if maxRequestSize > 0 && encoding == "" && r.raw.ContentLength > maxRequestSize {
+		return nil, errBodyTooLarge()
+	}
+	reader, err := decodeBody(r.raw.Body, encoding)
+	if err != nil {
+		return nil, err
+	}
+	if maxRequestSize > 0 {
+		// read one byte more to tell a body of exactly the limit from a larger one
+		reader = io.LimitReader(reader, maxRequestSize+1)
 	}
 	body, err := ioutil.ReadAll(reader)
 	if err != nil {
-		return err
+		if encoding != "" {
+			return nil, ErrBadRequest("Malformed " + encoding + " body").Wrap(err)
+		}
+		return nil, err
 	}
-	if err := r.raw.Body.Close(); err != nil {
-		return err
+	if maxRequestSize > 0 && int64(len(body)) > maxRequestSize {
+		return nil, errBodyTooLarge()
 	}
-	if err := json.Unmarshal(body, v); err != nil {
-		return err
+	return body, nil
+}
+
+// decodeBody decompresses a body with a Content-Encoding. Unsupported encodings fail with a 415.
+func decodeBody(body io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case EncodingGzip:
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, ErrBadRequest("Malformed gzip body").Wrap(err)
+		}
+		return gz, nil
+	case EncodingDeflate:
+		// deflate in HTTP is the zlib format
+		zr, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, ErrBadRequest("Malformed deflate body").Wrap(err)
+		}
+		return zr, nil
 	}
-	return nil
+	return nil, NewHTTPError(http.StatusUnsupportedMediaType, "unsupported_encoding", "Request bodies must be gzip or deflate encoded")
+}
+
+func errBodyTooLarge() *HTTPError {
+	return NewHTTPError(http.StatusRequestEntityTooLarge, "body_too_large", "Request body too large")
 }
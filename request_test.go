@@ -1,7 +1,13 @@
 package jsonserv
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -123,3 +129,72 @@ func TestRequest_ParseBody_too_small(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 }
+
+func TestRequest_ParseBody_malformed(t *testing.T) {
+	var body []int
+
+	r := mockRequest()
+	req := newRequest(r)
+
+	err := req.ParseBody(&body)
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	if asHTTPError(err).Status != http.StatusBadRequest {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func compressedRequest(t *testing.T, encoding string, body []byte) *Request {
+	var buf bytes.Buffer
+	switch encoding {
+	case EncodingGzip:
+		gz := gzip.NewWriter(&buf)
+		gz.Write(body)
+		gz.Close()
+	case EncodingDeflate:
+		zw := zlib.NewWriter(&buf)
+		zw.Write(body)
+		zw.Close()
+	default:
+		buf.Write(body)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", &buf)
+	r.Header.Set(headerContentEncoding, encoding)
+	return newRequest(r)
+}
+
+func TestRequest_ParseBody_compressed(t *testing.T) {
+	for _, encoding := range []string{EncodingGzip, EncodingDeflate} {
+		var body map[string]string
+		req := compressedRequest(t, encoding, []byte(`{"foo":"bar"}`))
+		if err := req.ParseBody(&body); err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if body["foo"] != "bar" {
+			t.Fatalf("%s: unexpected body %v", encoding, body)
+		}
+	}
+}
+
+func TestRequest_ParseBody_decompressed_limit(t *testing.T) {
+	var body map[string]string
+	req := compressedRequest(t, EncodingGzip, []byte(`{"foo":"`+strings.Repeat("a", 10000)+`"}`))
+	req.SetMiddlewareVar(MaxBodySize, int64(1000))
+	if err := req.ParseBody(&body); asHTTPError(err).Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestRequest_ParseBody_unsupported_encoding(t *testing.T) {
+	var body map[string]string
+	req := compressedRequest(t, EncodingBrotli, []byte(`{}`))
+	if err := req.ParseBody(&body); asHTTPError(err).Status != http.StatusUnsupportedMediaType {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req = compressedRequest(t, EncodingGzip, nil)
+	req.raw.Body = ioutil.NopCloser(strings.NewReader("not gzip"))
+	if err := req.ParseBody(&body); asHTTPError(err).Status != http.StatusBadRequest {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
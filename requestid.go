@@ -0,0 +1,151 @@
+package jsonserv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	RequestIDVar           = "request_id"
+	defaultRequestIDHeader = "X-Request-ID"
+	maxRequestIDLength     = 128
+	crockfordBase32        = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// RequestIDOptions configure the request ID middleware
+type RequestIDOptions struct {
+	// Header carries the ID, X-Request-ID if empty
+	Header string
+	// Generate creates IDs for requests without a valid one, NewULID if nil
+	Generate func() string
+	// Validate accepts the IDs of incoming requests, ValidRequestID if nil
+	Validate func(id string) bool
+}
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// requestID is an ID and the header it travels in
+type requestID struct {
+	id, header string
+}
+
+type requestIDMiddleware struct {
+	options RequestIDOptions
+}
+
+// NewRequestIDMiddleware creates a middleware that identifies requests with the ID in their
+// header, or a new one if it is missing or invalid. The ID is echoed in the response header,
+// logged with every framework log entry and included in error bodies. It is also put in the
+// request context, where NewRequestIDTransport picks it up for outbound calls.
+func NewRequestIDMiddleware(options RequestIDOptions) Middleware {
+	if options.Header == "" {
+		options.Header = defaultRequestIDHeader
+	}
+	if options.Generate == nil {
+		options.Generate = NewULID
+	}
+	if options.Validate == nil {
+		options.Validate = ValidRequestID
+	}
+	return &requestIDMiddleware{options: options}
+}
+
+func (m *requestIDMiddleware) Ingress(app interface{}, req *Request, res *Response) {
+	id := req.Header().Get(m.options.Header)
+	if id == "" || !m.options.Validate(id) {
+		id = m.options.Generate()
+	}
+	req.SetMiddlewareVar(RequestIDVar, id)
+	req.raw = req.raw.WithContext(context.WithValue(req.raw.Context(), requestIDKey{}, requestID{id: id, header: m.options.Header}))
+	res.Writer.Header().Set(m.options.Header, id)
+}
+
+func (m *requestIDMiddleware) Egress(app interface{}, req *Request, res *Response) {
+}
+
+// RequestID is the ID of the request, empty without the request ID middleware
+func (r *Request) RequestID() string {
+	return r.GetOptionalMiddlewareVar(RequestIDVar, "").(string)
+}
+
+// RequestIDFromContext is the request ID in a context, such as that of Request.Context
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(requestID)
+	return id.id
+}
+
+// requestIDTransport sets the request ID of the context on outbound requests
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+// NewRequestIDTransport creates a transport that passes the request ID in the context of
+// outbound requests on in the same header it came in. A nil base uses http.DefaultTransport.
+func NewRequestIDTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &requestIDTransport{base: base}
+}
+
+func (t *requestIDTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	id, ok := r.Context().Value(requestIDKey{}).(requestID)
+	if !ok || r.Header.Get(id.header) != "" {
+		return t.base.RoundTrip(r)
+	}
+	// round trippers must not modify the request
+	r = r.Clone(r.Context())
+	r.Header.Set(id.header, id.id)
+	return t.base.RoundTrip(r)
+}
+
+// ValidRequestID accepts IDs of up to 128 letters, digits, '-', '_', '.' and ':', which are
+// safe to log and echo
+func ValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewULID creates a ULID, a lexicographically sortable ID of a millisecond timestamp and
+// 80 random bits
+func NewULID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(b[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:], uint32(ms))
+	rand.Read(b[6:])
+
+	// 128 bits in 26 base32 characters, the first holding the top 3 bits
+	var s [26]byte
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	for i := 25; i >= 0; i-- {
+		s[i] = crockfordBase32[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
+
+// NewUUID creates a random (version 4) UUID
+func NewUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
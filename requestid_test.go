@@ -0,0 +1,107 @@
+package jsonserv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+func requestIDServer(options RequestIDOptions, logger Logger) *JsonServer {
+	return New().SetLogger(logger).
+		AddMiddleware(NewRequestIDMiddleware(options)).
+		AddMiddleware(NewLoggingMiddleware(false)).
+		AddRoute(http.MethodGet, "Missing", "/missing", func(app interface{}, r *Request, out *Response) {
+			out.Error(ErrNotFound(""))
+		})
+}
+
+func TestRequestIDMiddleware_generates(t *testing.T) {
+	logger := &recordingLogger{}
+	w, body := serveJSON(t, requestIDServer(RequestIDOptions{}, logger), http.MethodGet, "/missing")
+	id := w.Header().Get(defaultRequestIDHeader)
+	if len(id) != 26 || !ValidRequestID(id) {
+		t.Fatalf("Unexpected id: %q", id)
+	}
+	if body["request_id"] != id {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+	if logger.entries[0].fields["request_id"] != id {
+		t.Fatalf("Unexpected entry: %v", logger.entries[0])
+	}
+}
+
+func TestRequestIDMiddleware_incoming(t *testing.T) {
+	s := requestIDServer(RequestIDOptions{Header: "X-Trace", Generate: func() string { return "generated" }}, &recordingLogger{}).
+		SetProblemJSON(true)
+	for incoming, expected := range map[string]string{
+		"abc-123":         "abc-123",
+		"":                "generated",
+		"has spaces\n":    "generated",
+		"<script>":        "generated",
+		"trace:1.2_three": "trace:1.2_three",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/missing", nil)
+		r.Header.Set("X-Trace", incoming)
+		w := httptest.NewRecorder()
+		s.createRouter().ServeHTTP(w, r)
+		if w.Header().Get("X-Trace") != expected {
+			t.Errorf("%q: unexpected id %q", incoming, w.Header().Get("X-Trace"))
+		}
+		if !regexp.MustCompile(`"request_id":"` + regexp.QuoteMeta(expected) + `"`).Match(w.Body.Bytes()) {
+			t.Errorf("%q: unexpected problem %s", incoming, w.Body.String())
+		}
+	}
+}
+
+type headerRoundTripper struct {
+	header http.Header
+}
+
+func (t *headerRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.header = r.Header
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: r}, nil
+}
+
+func TestNewRequestIDTransport(t *testing.T) {
+	base := &headerRoundTripper{}
+	client := &http.Client{Transport: NewRequestIDTransport(base)}
+	s := requestIDServer(RequestIDOptions{Header: "X-Trace"}, &recordingLogger{}).
+		AddRoute(http.MethodGet, "Proxy", "/proxy", func(app interface{}, r *Request, out *Response) {
+			if RequestIDFromContext(r.Context()) != r.RequestID() {
+				t.Errorf("Context id %q differs from %q", RequestIDFromContext(r.Context()), r.RequestID())
+			}
+			outbound, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, "http://upstream/", nil)
+			client.Do(outbound)
+			if outbound.Header.Get("X-Trace") != "" {
+				t.Error("Outbound request was modified")
+			}
+			out.Ok(nil)
+		})
+	r := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+	r.Header.Set("X-Trace", "upstream-1")
+	s.createRouter().ServeHTTP(httptest.NewRecorder(), r)
+	if base.header.Get("X-Trace") != "upstream-1" {
+		t.Fatalf("Unexpected outbound headers: %v", base.header)
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = NewULID()
+	}
+	if !regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`).MatchString(ids[0]) {
+		t.Fatalf("Malformed ULID: %s", ids[0])
+	}
+	if ids[0][:10] != ids[99][:10] && !sort.StringsAreSorted([]string{ids[0][:10], ids[99][:10]}) {
+		t.Fatalf("Timestamps not sortable: %s %s", ids[0], ids[99])
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	if id := NewUUID(); !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Fatalf("Malformed UUID: %s", id)
+	}
+}
@@ -1,6 +1,9 @@
 package jsonserv
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 type ResponseWriter interface {
 	http.ResponseWriter
@@ -13,15 +16,44 @@ type ResponseWriterCloser struct {
 
 func (r ResponseWriterCloser) Close() {}
 
+func (r ResponseWriterCloser) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 type Response struct {
 	Code   int
 	Err    error
 	Body   interface{}
 	Writer ResponseWriter
+	// ETag is the entity tag of the body, sent with successful GET responses
+	ETag string
+	// LastModified is when the body last changed, sent with successful GET responses
+	LastModified time.Time
+	// encoder is the negotiated encoder of the body
+	encoder Encoder
+	// streamOnly is set when no encoder is acceptable, but the view may still stream
+	streamOnly bool
+	// page is set by Page until the body is built
+	page *page
+	// meta and warnings are written in envelope mode
+	meta     map[string]interface{}
+	warnings []Warning
+	// streamed is set when the view wrote the response itself
+	streamed bool
+	// stream is set by StreamArray and StreamNDJSON until it is written
+	stream *itemStream
+	// plain bodies are always JSON and never wrapped in an envelope
+	plain bool
+	// halted responses skip the rest of the middleware and the view
+	halted bool
+	// finished are called once the response has been sent
+	finished []func()
 }
 
 func newWrappedResponse(w http.ResponseWriter) *Response {
-	return newResponse(ResponseWriterCloser{w})
+	return newResponse(DecorateWriter(w, WriterDecorator{}))
 }
 
 func newResponse(w ResponseWriter) *Response {
@@ -45,10 +77,33 @@ func (r *Response) Ok(body interface{}) *Response {
 	return r.Done(http.StatusOK, body)
 }
 
+// Error fails the response. The status comes from an HTTPError in the error's chain,
+// otherwise it is a 500.
 func (r *Response) Error(err error) *Response {
-	r.Code = http.StatusInternalServerError
+	r.Code = asHTTPError(err).Status
 	r.Err = err
 	r.Body = nil
+	r.stream = nil
+	return r
+}
+
+// OnFinish calls f once the response has been sent and the writer closed, when the
+// status and size written are final
+func (r *Response) OnFinish(f func()) *Response {
+	r.finished = append(r.finished, f)
+	return r
+}
+
+func (r *Response) finish() {
+	for _, f := range r.finished {
+		f()
+	}
+}
+
+// Halt stops a middleware's Ingress from passing the request on. The view and the Ingress of
+// later middleware are skipped, and only the middleware that ran get Egress.
+func (r *Response) Halt() *Response {
+	r.halted = true
 	return r
 }
 
@@ -0,0 +1,187 @@
+package jsonserv
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	rotatedFileSeparator  = "."
+	rotatedFileTimeFormat = "20060102T150405.000000000"
+)
+
+// RotateOptions configure a RotatingFile
+type RotateOptions struct {
+	// MaxSize rotates the file before it grows beyond it, never if 0
+	MaxSize int64
+	// MaxAge rotates the file once it has been written to for longer, never if 0
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files kept, all of them if 0
+	MaxBackups int
+	// ReopenOnSIGHUP reopens the file when the process gets a SIGHUP, for external log rotation
+	ReopenOnSIGHUP bool
+}
+
+// RotatingFile is an io.Writer appending to a file that is rotated by size and age.
+// Rotated files get a timestamp suffix. When a rotation fails, writes keep appending to the file
+// and report the error.
+type RotatingFile struct {
+	path    string
+	options RotateOptions
+	mu      sync.Mutex
+	// file is nil once closed, or while a reopen failed and is retried by Write
+	file    *os.File
+	closed  bool
+	size    int64
+	opened  time.Time
+	signals chan os.Signal
+	now     func() time.Time
+}
+
+// OpenRotatingFile opens a file for appending, creating it if needed
+func OpenRotatingFile(path string, options RotateOptions) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, options: options, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	if options.ReopenOnSIGHUP {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGHUP)
+		f.signals = signals
+		go func() {
+			for range signals {
+				f.Reopen()
+			}
+		}()
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if f.file != nil && f.size > 0 && f.due(int64(len(p))) {
+		rotateErr = f.rotate()
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// due reports if writing n more bytes needs a new file
+func (f *RotatingFile) due(n int64) bool {
+	if f.options.MaxSize > 0 && f.size+n > f.options.MaxSize {
+		return true
+	}
+	return f.options.MaxAge > 0 && f.now().Sub(f.opened) >= f.options.MaxAge
+}
+
+// rotate moves the file aside and starts a new one. If it can't be moved, the file is
+// reopened and appended to as before.
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err == nil {
+		err = os.Rename(f.path, f.path+rotatedFileSeparator+f.now().UTC().Format(rotatedFileTimeFormat))
+	}
+	if openErr := f.open(); err == nil {
+		err = openErr
+	}
+	if err != nil {
+		return err
+	}
+	return f.removeBackups()
+}
+
+// removeBackups deletes the oldest rotated files beyond MaxBackups
+func (f *RotatingFile) removeBackups() error {
+	if f.options.MaxBackups <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(f.path + rotatedFileSeparator + "*")
+	if err != nil {
+		return err
+	}
+	// only files rotated by us, not other files that start with the same name
+	var backups []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, f.path+rotatedFileSeparator)
+		if _, err := time.Parse(rotatedFileTimeFormat, suffix); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	// timestamps sort in the order they were rotated
+	sort.Strings(backups)
+	for len(backups) > f.options.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Reopen closes and reopens the file, after it was moved by external log rotation.
+// If it can't be reopened, Write tries again.
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
+
+// Close closes the file and stops reopening it on SIGHUP
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.signals != nil {
+		signal.Stop(f.signals)
+		close(f.signals)
+		f.signals = nil
+	}
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,127 @@
+package jsonserv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile_size(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// not a backup, despite the name
+	sibling := path + ".bak"
+	ioutil.WriteFile(sibling, []byte("keep"), 0644)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	f.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, _ := filepath.Glob(path + ".2*")
+	if len(backups) != 2 {
+		t.Fatalf("Unexpected backups: %v", backups)
+	}
+	if _, err := os.Stat(sibling); err != nil {
+		t.Fatalf("Sibling file removed: %v", err)
+	}
+	newest, _ := ioutil.ReadFile(backups[1])
+	current, _ := ioutil.ReadFile(path)
+	if string(newest) != "third\n" || string(current) != "fourth\n" {
+		t.Fatalf("Unexpected contents: %q %q", newest, current)
+	}
+}
+
+func TestRotatingFile_age(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte("old\n"))
+	f.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	f.Write([]byte("new\n"))
+	if current, _ := ioutil.ReadFile(path); string(current) != "new\n" {
+		t.Fatalf("Unexpected contents: %q", current)
+	}
+}
+
+func TestRotatingFile_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := OpenRotatingFile(path, RotateOptions{ReopenOnSIGHUP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("before\n"))
+	os.Rename(path, filepath.Join(dir, "moved.log"))
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+	f.Close()
+	if current, _ := ioutil.ReadFile(path); string(current) != "after\n" {
+		t.Fatalf("Unexpected contents: %q", current)
+	}
+	if _, err := f.Write([]byte("closed\n")); err == nil {
+		t.Fatal("Expected an error writing a closed file")
+	}
+}
+
+func TestRotatingFile_rotate_failure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	// the backup name is taken by a directory, so the file can't be moved there
+	taken := path + "." + now.Format(rotatedFileTimeFormat)
+	os.MkdirAll(filepath.Join(taken, "dir"), 0755)
+
+	f.Write([]byte("first line\n"))
+	if _, err := f.Write([]byte("second\n")); err == nil {
+		t.Fatal("Expected the rotation error")
+	}
+	if _, err := f.Write([]byte("third\n")); err == nil {
+		t.Fatal("Expected the rotation error")
+	}
+	if current, _ := ioutil.ReadFile(path); string(current) != "first line\nsecond\nthird\n" {
+		t.Fatalf("Unexpected contents: %q", current)
+	}
+}
+
+func TestRotatingFile_Reopen_failure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := OpenRotatingFile(path, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	os.Rename(path, filepath.Join(dir, "moved.log"))
+	os.Mkdir(path, 0755)
+	if err := f.Reopen(); err == nil {
+		t.Fatal("Expected an error reopening a directory")
+	}
+	os.Remove(path)
+	if _, err := f.Write([]byte("after\n")); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := ioutil.ReadFile(path); string(current) != "after\n" {
+		t.Fatalf("Unexpected contents: %q", current)
+	}
+}
@@ -7,6 +7,8 @@ type route struct {
 	path   string
 	method string
 	view   View
+	// contentType is the media type written by the view of a stream route
+	contentType string
 }
 
 func (r route) String() string {
@@ -15,11 +17,13 @@ func (r route) String() string {
 
 type routes []*route
 
-func (r *routes) Add(method, name, path string, view View) {
-	*r = append(*r, &route{
+func (r *routes) Add(method, name, path string, view View) *route {
+	added := &route{
 		method: method,
 		name:   name,
 		path:   path,
 		view:   view,
-	})
+	}
+	*r = append(*r, added)
+	return added
 }
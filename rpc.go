@@ -0,0 +1,207 @@
+package jsonserv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+const rpcVersion = "2.0"
+
+// Standard JSON-RPC 2.0 error codes
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	// RPCServerError is the code of HTTPErrors that have no JSON-RPC equivalent
+	RPCServerError = -32000
+)
+
+// RPCMethods maps JSON-RPC method names to views. The params of a call are the body of the
+// request the view gets, so Request.ParseBody decodes them, and the body of the response is
+// the result.
+type RPCMethods map[string]View
+
+// RPCError fails a JSON-RPC call with a code of its own. Views fail with it like any other error.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+type rpcResult struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcFailure struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Error   *RPCError       `json:"error"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// AddRPC serves a JSON-RPC 2.0 endpoint on a path, with batches and notifications. The
+// request goes through the middleware once, and every call gets the App and a copy of its
+// middleware vars. Responses are never wrapped in an envelope.
+func (s *JsonServer) AddRPC(path string, methods RPCMethods) *JsonServer {
+	return s.AddRoute(http.MethodPost, "RPC "+path, path, func(app interface{}, r *Request, out *Response) {
+		s.serveRPC(app, r, out, methods)
+	})
+}
+
+func (s *JsonServer) serveRPC(app interface{}, req *Request, res *Response, methods RPCMethods) {
+	if res.Err != nil {
+		return
+	}
+	body, err := req.readBody()
+	if err != nil {
+		res.Error(err)
+		return
+	}
+	res.plain = true
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		res.Ok(rpcError(nil, &RPCError{Code: RPCParseError, Message: "Parse error"}))
+		return
+	}
+	if body[0] != '[' {
+		if response := s.callRPC(app, req, res, methods, body); response != nil {
+			res.Ok(response)
+		} else {
+			res.Empty(http.StatusNoContent)
+		}
+		return
+	}
+	var calls []json.RawMessage
+	json.Unmarshal(body, &calls)
+	if len(calls) == 0 {
+		res.Ok(rpcError(nil, &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request"}))
+		return
+	}
+	responses := make([]interface{}, 0, len(calls))
+	for _, call := range calls {
+		if response := s.callRPC(app, req, res, methods, call); response != nil {
+			responses = append(responses, response)
+		}
+	}
+	if len(responses) == 0 {
+		res.Empty(http.StatusNoContent)
+		return
+	}
+	res.Ok(responses)
+}
+
+// callRPC runs a single call. Notifications have no response.
+func (s *JsonServer) callRPC(app interface{}, req *Request, out *Response, methods RPCMethods, raw json.RawMessage) interface{} {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return rpcError(nil, &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request"})
+	}
+	id, hasID := members["id"]
+	if !validRPCID(id) {
+		return rpcError(nil, &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request"})
+	}
+	var version, method string
+	if json.Unmarshal(members["jsonrpc"], &version) != nil || version != rpcVersion ||
+		json.Unmarshal(members["method"], &method) != nil || method == "" {
+		return rpcError(id, &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request"})
+	}
+	params, hasParams := members["params"]
+	if hasParams && (len(params) == 0 || (params[0] != '{' && params[0] != '[')) {
+		return rpcError(id, &RPCError{Code: RPCInvalidParams, Message: "Invalid params"})
+	}
+	view, ok := methods[method]
+	if !ok {
+		if !hasID {
+			return nil
+		}
+		return rpcError(id, &RPCError{Code: RPCMethodNotFound, Message: "Method not found"})
+	}
+
+	call := req.rpcCall(method, params)
+	// headers set by calls are sent with the HTTP response
+	res := newResponse(out.Writer)
+	runView(view, app, call, res)
+	s.errors.resolve(res)
+	if !hasID {
+		return nil
+	}
+	if res.Err != nil {
+		return rpcError(id, toRPCError(call, res.Err))
+	}
+	return rpcResult{JSONRPC: rpcVersion, Result: res.Body, ID: id}
+}
+
+// rpcCall is the request of a single call, with the params as its body
+func (r *Request) rpcCall(method string, params json.RawMessage) *Request {
+	raw := r.raw.Clone(r.raw.Context())
+	raw.Header.Del(headerContentEncoding)
+	raw.Body = ioutil.NopCloser(bytes.NewReader(params))
+	raw.ContentLength = int64(len(params))
+	call := newRequest(raw)
+	call.name = method
+	call.logger, call.logOptions, call.jsonOptions = r.logger, r.logOptions, r.jsonOptions
+	for key, value := range r.vars {
+		call.SetMiddlewareVar(key, value)
+	}
+	return call
+}
+
+// validRPCID reports if an id is a string, number or null, or missing
+func validRPCID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var v interface{}
+	if err := json.Unmarshal(id, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case nil, string, float64:
+		return true
+	}
+	return false
+}
+
+func rpcError(id json.RawMessage, err *RPCError) rpcFailure {
+	return rpcFailure{JSONRPC: rpcVersion, Error: err, ID: id}
+}
+
+// toRPCError converts the error of a call. Bad requests are invalid params, server errors are
+// internal errors and other HTTPErrors keep their status and code in the data.
+func toRPCError(req *Request, err error) *RPCError {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	httpErr := asHTTPError(err)
+	body := errorBody(req, err)
+	data := map[string]interface{}{"status": httpErr.Status}
+	for _, key := range []string{"code", "details", "cause", "request_id"} {
+		if value, ok := body[key]; ok {
+			data[key] = value
+		}
+	}
+	switch {
+	case httpErr.Status >= http.StatusInternalServerError:
+		rpcErr = &RPCError{Code: RPCInternalError, Message: "Internal error"}
+		if message, ok := body["error"].(string); ok {
+			data["error"] = message
+		}
+	case httpErr.Status == http.StatusBadRequest || httpErr.Status == http.StatusUnprocessableEntity:
+		rpcErr = &RPCError{Code: RPCInvalidParams, Message: httpErr.message()}
+	default:
+		rpcErr = &RPCError{Code: RPCServerError, Message: httpErr.message()}
+	}
+	rpcErr.Data = data
+	return rpcErr
+}
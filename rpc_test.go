@@ -0,0 +1,119 @@
+package jsonserv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type rpcUserMiddleware struct{}
+
+func (m rpcUserMiddleware) Ingress(app interface{}, req *Request, res *Response) {
+	req.SetMiddlewareVar("user", "alice")
+}
+
+func (m rpcUserMiddleware) Egress(app interface{}, req *Request, res *Response) {}
+
+func rpcServer() *JsonServer {
+	return New().SetApp(10).SetEnvelope(true).AddMiddleware(rpcUserMiddleware{}).
+		AddRPC("/rpc", RPCMethods{
+			"add": func(app interface{}, r *Request, out *Response) {
+				var params []int
+				if err := r.ParseBody(&params); err != nil {
+					out.Error(err)
+					return
+				}
+				sum := app.(int)
+				for _, n := range params {
+					sum += n
+				}
+				out.Ok(sum)
+			},
+			"whoami": func(app interface{}, r *Request, out *Response) {
+				out.Ok(r.GetMiddlewareVar("user"))
+			},
+			"missing": func(app interface{}, r *Request, out *Response) {
+				out.Error(ErrNotFound("No such thing"))
+			},
+			"custom": func(app interface{}, r *Request, out *Response) {
+				out.Error(&RPCError{Code: 42, Message: "Custom"})
+			},
+			"panic": func(app interface{}, r *Request, out *Response) {
+				panic("boom")
+			},
+		})
+}
+
+func callRPC(t *testing.T, body string) (*httptest.ResponseRecorder, interface{}) {
+	w := httptest.NewRecorder()
+	rpcServer().createRouter().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+	if w.Code == http.StatusNoContent {
+		return w, nil
+	}
+	var response interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid body %q: %v", w.Body.String(), err)
+	}
+	return w, response
+}
+
+func TestAddRPC_call(t *testing.T) {
+	_, response := callRPC(t, `{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": 1}`)
+	expected := map[string]interface{}{"jsonrpc": "2.0", "result": float64(13), "id": float64(1)}
+	if !reflect.DeepEqual(response, expected) {
+		t.Fatalf("Unexpected response: %v", response)
+	}
+}
+
+func TestAddRPC_errors(t *testing.T) {
+	for body, code := range map[string]float64{
+		`{"jsonrpc": "2.0", "method": "add", "params": [1,`: RPCParseError,
+		`[]`: RPCInvalidRequest,
+		`{"jsonrpc": "1.0", "method": "add", "id": 1}`:                     RPCInvalidRequest,
+		`{"jsonrpc": "2.0", "method": "nope", "id": 1}`:                    RPCMethodNotFound,
+		`{"jsonrpc": "2.0", "method": "add", "params": "x", "id": 1}`:      RPCInvalidParams,
+		`{"jsonrpc": "2.0", "method": "add", "params": {"a": 1}, "id": 1}`: RPCInvalidParams,
+		`{"jsonrpc": "2.0", "method": "panic", "id": 1}`:                   RPCInternalError,
+		`{"jsonrpc": "2.0", "method": "missing", "id": 1}`:                 RPCServerError,
+		`{"jsonrpc": "2.0", "method": "custom", "id": "a"}`:                42,
+	} {
+		_, response := callRPC(t, body)
+		rpcErr, ok := response.(map[string]interface{})["error"].(map[string]interface{})
+		if !ok || rpcErr["code"] != code {
+			t.Errorf("%s: unexpected response %v", body, response)
+		}
+	}
+}
+
+func TestAddRPC_batch(t *testing.T) {
+	_, response := callRPC(t, `[
+		{"jsonrpc": "2.0", "method": "whoami", "id": "a"},
+		{"jsonrpc": "2.0", "method": "add", "params": [1]},
+		1,
+		{"jsonrpc": "2.0", "method": "missing", "id": 2}
+	]`)
+	responses := response.([]interface{})
+	if len(responses) != 3 {
+		t.Fatalf("Unexpected responses: %v", responses)
+	}
+	if responses[0].(map[string]interface{})["result"] != "alice" {
+		t.Fatalf("Unexpected response: %v", responses[0])
+	}
+	if responses[1].(map[string]interface{})["id"] != nil {
+		t.Fatalf("Unexpected response: %v", responses[1])
+	}
+	data := responses[2].(map[string]interface{})["error"].(map[string]interface{})["data"].(map[string]interface{})
+	if data["status"] != float64(http.StatusNotFound) || data["code"] != "not_found" {
+		t.Fatalf("Unexpected data: %v", data)
+	}
+}
+
+func TestAddRPC_notifications(t *testing.T) {
+	w, _ := callRPC(t, `[{"jsonrpc": "2.0", "method": "add", "params": [1]}, {"jsonrpc": "2.0", "method": "nope"}]`)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Fatalf("Unexpected response: %d %q", w.Code, w.Body.String())
+	}
+}
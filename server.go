@@ -1,18 +1,21 @@
 package jsonserv
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"time"
 
 	"github.com/gorilla/mux"
-	"net"
-	"time"
-	"errors"
 )
 
 const (
 	contentTypeHeader = "Content-type"
-	contentTypeJson = "application/json"
-	emptyBody = "{}"
+	contentTypeJson   = "application/json"
+	emptyBody         = "{}"
 )
 
 type JsonServer struct {
@@ -20,12 +23,25 @@ type JsonServer struct {
 	routes      routes
 	Middlewares middlewares
 	Listener    *net.TCPListener
+	problemJSON bool
+	errors      errorMappers
+	streaming   bool
+	encoders    encoders
+	jsonOptions JSONOptions
+	router      *mux.Router
+	envelope    bool
+	// webSocketOptions configure every WebSocket route
+	webSocketOptions WebSocketOptions
+	logger           Logger
+	logOptions       LogOptions
 }
 
 func New() *JsonServer {
 	return &JsonServer{
 		routes:      make(routes, 0, 16),
 		Middlewares: make(middlewares, 0, 2),
+		encoders:    encoders{jsonEncoder{}},
+		logger:      NewStdLogger(log.Default()),
 	}
 }
 
@@ -34,16 +50,74 @@ func (s *JsonServer) AddRoute(method, name, path string, view View) *JsonServer
 	return s
 }
 
+// AddStreamRoute adds a route whose view writes its own media type, such as
+// "text/event-stream" with Response.SSE or "application/x-ndjson" with Response.StreamNDJSON.
+// Requests that don't accept the media type fail with a 406 before the view runs. Views of
+// ordinary routes can stream too, but they run for any client that accepts a stream.
+func (s *JsonServer) AddStreamRoute(method, name, path, contentType string, view View) *JsonServer {
+	s.routes.Add(method, name, path, view).contentType = contentType
+	return s
+}
+
 func (s *JsonServer) AddMiddleware(middleware Middleware) *JsonServer {
 	s.Middlewares = append(s.Middlewares, middleware)
 	return s
 }
 
+// AddEncoder makes response bodies available in another media type, chosen with the
+// Accept header. JSON is always available and preferred when clients accept anything.
+func (s *JsonServer) AddEncoder(encoder Encoder) *JsonServer {
+	s.encoders = append(s.encoders, encoder)
+	return s
+}
+
+// SetJSONOptions configures how JSON bodies are encoded
+func (s *JsonServer) SetJSONOptions(options JSONOptions) *JsonServer {
+	s.jsonOptions = options
+	return s
+}
+
 func (s *JsonServer) SetApp(app interface{}) *JsonServer {
 	s.App = app
 	return s
 }
 
+// SetProblemJSON renders every error as an RFC 7807 application/problem+json response
+func (s *JsonServer) SetProblemJSON(enabled bool) *JsonServer {
+	s.problemJSON = enabled
+	return s
+}
+
+// MapError responds with the status and code when a view fails with the target error.
+// The target is matched with errors.Is, or with errors.As when it is a nil pointer
+// such as (*os.PathError)(nil). The status text is used as the public message.
+func (s *JsonServer) MapError(target error, status int, code string) *JsonServer {
+	return s.MapErrorFunc(matchError(target, status, code))
+}
+
+// MapErrorFunc converts errors that views fail with using a custom mapper.
+// Mappers are tried in the order they were added.
+func (s *JsonServer) MapErrorFunc(mapper ErrorMapper) *JsonServer {
+	s.errors = append(s.errors, mapper)
+	return s
+}
+
+// SetEnvelope wraps every body in {"data", "meta", "errors", "warnings"}. Views add meta
+// and warnings with Response.AddMeta and Response.AddWarning. Error entries are problem
+// objects when problem+json is enabled, but the envelope is always application/json.
+func (s *JsonServer) SetEnvelope(enabled bool) *JsonServer {
+	s.envelope = enabled
+	return s
+}
+
+// SetStreaming encodes response bodies straight to the client instead of buffering them.
+// This saves memory on large bodies, but encoding failures can no longer become a 500
+// and responses have no Content-Length.
+func (s *JsonServer) SetStreaming(enabled bool) *JsonServer {
+	s.streaming = enabled
+	return s
+}
+
 func (s *JsonServer) Serve(addr string) error {
 	router := s.createRouter()
 	server := &http.Server{Addr: addr, Handler: router}
@@ -67,38 +141,72 @@ func (s *JsonServer) Close() error {
 func (s *JsonServer) createRouter() *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
 	for _, route := range s.routes {
-		handler := s.newHandler(route.name, route.view)
+		handler := s.newHandler(route)
 		router.Methods(route.method).
 			Path(route.path).
 			Name(route.name).
 			Handler(handler)
 	}
 	router.NotFoundHandler = s.newNotFoundHandler()
+	router.MethodNotAllowedHandler = s.newMethodNotAllowedHandler()
+	s.router = router
 	return router
 }
 
 func (s *JsonServer) newNotFoundHandler() http.Handler {
-	return s.newHandler("NotFound", func(app interface{}, r *Request, out *Response) {
+	return s.newHandler(&route{name: "NotFound", view: func(app interface{}, r *Request, out *Response) {
+		if s.problemJSON {
+			out.Error(ErrNotFound(""))
+			return
+		}
 		out.Empty(http.StatusNotFound)
-	})
+	}})
+}
+
+func (s *JsonServer) newMethodNotAllowedHandler() http.Handler {
+	return s.newHandler(&route{name: "MethodNotAllowed", view: func(app interface{}, r *Request, out *Response) {
+		out.Error(NewHTTPError(http.StatusMethodNotAllowed, "method_not_allowed", ""))
+	}})
 }
 
-func (s *JsonServer) newHandler(name string, view View) http.Handler {
+func (s *JsonServer) newHandler(route *route) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req := newRequest(r)
+		req.name = route.name
+		req.logger, req.logOptions, req.jsonOptions = s.logger, s.logOptions, s.jsonOptions
 		res := newWrappedResponse(w)
 		defer func() {
 			res.Writer.Close()
+			res.finish()
 		}()
 
-		s.Middlewares.Ingress(s.App, req, res)
-		view(s.App, req, res)
-		s.Middlewares.Egress(s.App, req, res)
+		ran := s.Middlewares.Ingress(s.App, req, res)
+		if !res.halted && s.negotiateEncoder(req, res, route.contentType) {
+			runView(route.view, s.App, req, res)
+			s.checkStreamed(req, res)
+		}
+		s.finishPage(req, res)
+		s.errors.resolve(res)
+		ran.Egress(s.App, req, res)
 
-		respond(req, res)
+		s.respond(req, res)
 	})
 }
 
+// runView calls the view, turning panics into internal errors
+func runView(view View, app interface{}, req *Request, res *Response) {
+	defer func() {
+		if p := recover(); p != nil {
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			req.Log(LevelError, "Panic serving request", Field{Key: "panic", Value: p}, Field{Key: "stack", Value: string(debug.Stack())})
+			res.Error(fmt.Errorf("panic: %v", p))
+		}
+	}()
+	view(app, req, res)
+}
+
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
 // connections. It's used by ListenAndServe and ListenAndServeTLS so
 // dead TCP connections (e.g. closing laptop mid-download) eventually
@@ -115,4 +223,4 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 	tc.SetKeepAlive(true)
 	tc.SetKeepAlivePeriod(3 * time.Minute)
 	return tc, nil
-}
\ No newline at end of file
+}
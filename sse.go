@@ -0,0 +1,151 @@
+package jsonserv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	contentTypeEventStream = "text/event-stream"
+	headerLastEventID      = "Last-Event-ID"
+	headerCacheControl     = "Cache-Control"
+)
+
+// Event is a single server-sent event
+type Event struct {
+	ID    string
+	Event string
+	// Data is sent as is if it is a string, otherwise it is encoded as JSON
+	Data interface{}
+	// Retry tells the client how long to wait before reconnecting
+	Retry time.Duration
+}
+
+// EventStream sends server-sent events to the client
+type EventStream struct {
+	// LastEventID is the Last-Event-ID the client reconnected with, empty on the first connection
+	LastEventID string
+	ctx         context.Context
+	mu          sync.Mutex
+	w           http.ResponseWriter
+}
+
+// SSE takes over the writer and streams server-sent events until stream returns or the
+// client goes away. A comment is sent every heartbeat to keep idle connections open, unless
+// it is 0. The response is not encoded afterwards, but middleware Egress still runs.
+// It works on any route. Routes that only serve events are better added with AddStreamRoute
+// and "text/event-stream", which rejects other clients before the view runs.
+func (r *Response) SSE(req *Request, heartbeat time.Duration, stream func(events *EventStream) error) *Response {
+	header := r.Writer.Header()
+	header.Set(contentTypeHeader, contentTypeEventStream)
+	header.Set(headerCacheControl, "no-cache")
+	header.Del(headerContentLength)
+	r.Code = http.StatusOK
+	r.Err = nil
+	r.Body = nil
+	r.streamed = true
+	r.Writer.WriteHeader(http.StatusOK)
+
+	ctx, cancel := context.WithCancel(req.Context())
+	events := &EventStream{
+		LastEventID: req.Header().Get(headerLastEventID),
+		ctx:         ctx,
+		w:           r.Writer,
+	}
+	events.flush()
+	var wg sync.WaitGroup
+	if heartbeat > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			events.heartbeat(heartbeat)
+		}()
+	}
+	err := stream(events)
+	cancel()
+	wg.Wait()
+	// a client going away is how streams usually end
+	if err != nil && !errors.Is(err, context.Canceled) && req.Context().Err() == nil {
+		r.Err = err
+	}
+	return r
+}
+
+// Context is done when the client goes away or the stream ends
+func (e *EventStream) Context() context.Context {
+	return e.ctx
+}
+
+// Send writes an event and flushes it to the client
+func (e *EventStream) Send(event Event) error {
+	var buf bytes.Buffer
+	if event.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", singleLine(event.ID))
+	}
+	if event.Event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", singleLine(event.Event))
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %d\n", event.Retry.Milliseconds())
+	}
+	data, ok := event.Data.(string)
+	if !ok && event.Data != nil {
+		b, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	for _, line := range strings.Split(lineBreaks.Replace(data), "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteByte('\n')
+	return e.write(buf.Bytes())
+}
+
+func (e *EventStream) write(b []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(b); err != nil {
+		return err
+	}
+	e.flush()
+	return nil
+}
+
+func (e *EventStream) flush() {
+	flush(e.w)
+}
+
+func (e *EventStream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-ticker.C:
+			if e.write([]byte(": heartbeat\n\n")) != nil {
+				return
+			}
+		}
+	}
+}
+
+// lineBreaks turns the CRLF, CR and LF line ends of SSE into LF
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// singleLine keeps a field from breaking out of its line
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,112 @@
+package jsonserv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponse_SSE(t *testing.T) {
+	s := New().AddStreamRoute(http.MethodGet, "Events", "/events", contentTypeEventStream, func(app interface{}, r *Request, out *Response) {
+		out.SSE(r, 0, func(events *EventStream) error {
+			if events.LastEventID != "41" {
+				t.Errorf("Unexpected last event id: %q", events.LastEventID)
+			}
+			events.Send(Event{ID: "42", Event: "update", Data: map[string]int{"n": 1}, Retry: time.Second})
+			events.Send(Event{Data: "a\nb"})
+			return events.Send(Event{Data: "c\revent: x\r\nd"})
+		})
+	})
+	w := serve(s, http.MethodGet, "/events", withHeader(headerAccept, contentTypeEventStream), withHeader(headerLastEventID, "41"))
+	if w.Code != http.StatusOK || w.Header().Get(contentTypeHeader) != contentTypeEventStream {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Header().Get(contentTypeHeader))
+	}
+	expected := "id: 42\nevent: update\nretry: 1000\ndata: {\"n\":1}\n\ndata: a\ndata: b\n\ndata: c\ndata: event: x\ndata: d\n\n"
+	if w.Body.String() != expected {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+	if !w.Flushed {
+		t.Fatal("Events were not flushed")
+	}
+}
+
+func TestResponse_SSE_heartbeat_and_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New().AddRoute(http.MethodGet, "Events", "/events", func(app interface{}, r *Request, out *Response) {
+		out.SSE(r, time.Millisecond, func(events *EventStream) error {
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+			<-events.Context().Done()
+			return events.Send(Event{Data: "late"})
+		})
+	})
+	w := serve(s, http.MethodGet, "/events", withContext(ctx))
+	body := w.Body.String()
+	if !strings.HasPrefix(body, ": heartbeat\n\n") || strings.Contains(body, "late") {
+		t.Fatalf("Unexpected body: %q", body)
+	}
+}
+
+func TestResponse_SSE_gzip_bypass(t *testing.T) {
+	var logged error
+	s := New().AddMiddleware(NewGzipMiddleware()).
+		AddMiddleware(egressFunc(func(res *Response) { logged = res.Err })).
+		AddRoute(http.MethodGet, "Events", "/events", func(app interface{}, r *Request, out *Response) {
+			out.SSE(r, 0, func(events *EventStream) error {
+				events.Send(Event{Data: "hello"})
+				return errors.New("broken")
+			})
+		})
+	w := serve(s, http.MethodGet, "/events", withHeader(headerAcceptEncoding, headerAcceptEncodingGzip))
+	if w.Header().Get(headerContentEncoding) != "" || w.Body.String() != "data: hello\n\n" {
+		t.Fatalf("Unexpected response: %v %q", w.Header(), w.Body.String())
+	}
+	if logged == nil || logged.Error() != "broken" || w.Code != http.StatusOK {
+		t.Fatalf("Unexpected error: %v", logged)
+	}
+}
+
+func TestResponse_SSE_not_acceptable(t *testing.T) {
+	ran := false
+	s := New().AddStreamRoute(http.MethodGet, "Events", "/events", contentTypeEventStream, func(app interface{}, r *Request, out *Response) {
+		ran = true
+		out.Ok("hi")
+	})
+	w := serve(s, http.MethodGet, "/events", withHeader(headerAccept, contentTypeJson))
+	if w.Code != http.StatusNotAcceptable || bytes.Contains(w.Body.Bytes(), []byte("hi")) {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	if ran {
+		t.Fatal("View ran for an unacceptable request")
+	}
+}
+
+func TestResponse_SSE_ordinary_route(t *testing.T) {
+	s := New().
+		AddRoute(http.MethodGet, "Events", "/events", func(app interface{}, r *Request, out *Response) {
+			out.SSE(r, 0, func(events *EventStream) error {
+				return events.Send(Event{Data: "hello"})
+			})
+		}).
+		AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {
+			out.Ok("hi")
+		})
+	w := serve(s, http.MethodGet, "/events", withHeader(headerAccept, contentTypeEventStream))
+	if w.Code != http.StatusOK || w.Header().Get(contentTypeHeader) != contentTypeEventStream || w.Body.String() != "data: hello\n\n" {
+		t.Fatalf("Unexpected response: %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+	w = serve(s, http.MethodGet, "/", withHeader(headerAccept, contentTypeEventStream))
+	if w.Code != http.StatusNotAcceptable || bytes.Contains(w.Body.Bytes(), []byte("hi")) {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+type egressFunc func(res *Response)
+
+func (f egressFunc) Ingress(app interface{}, req *Request, res *Response) {}
+
+func (f egressFunc) Egress(app interface{}, req *Request, res *Response) { f(res) }
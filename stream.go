@@ -0,0 +1,122 @@
+package jsonserv
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+const (
+	contentTypeNDJSON = "application/x-ndjson"
+	headerTrailer     = "Trailer"
+	// headerStreamError is the trailer that reports a stream failing partway through
+	headerStreamError = "X-Stream-Error"
+	// streamFlushInterval is the number of items written between flushes
+	streamFlushInterval = 100
+)
+
+// Iterator produces the items of a stream one at a time. It returns io.EOF after the last item.
+type Iterator func() (interface{}, error)
+
+// itemStream is a stream waiting to be written once the middleware has run
+type itemStream struct {
+	next   Iterator
+	ndjson bool
+}
+
+// StreamArray responds with a JSON array of the items of an iterator, encoding them as they
+// are produced instead of building the whole body. If the iterator fails before the first
+// item the response is an error as usual. A failure after that leaves the array unterminated
+// and sets the X-Stream-Error trailer.
+func (r *Response) StreamArray(next Iterator) *Response {
+	r.stream = &itemStream{next: next}
+	return r.Ok(nil)
+}
+
+// StreamNDJSON responds with the items of an iterator as newline delimited JSON. A failure
+// partway through ends the stream with an {"error": ...} record and the X-Stream-Error trailer.
+func (r *Response) StreamNDJSON(next Iterator) *Response {
+	r.stream = &itemStream{next: next, ndjson: true}
+	return r.Ok(nil)
+}
+
+// writeStream writes the items of a stream with chunked encoding, flushing periodically.
+// Streams are always JSON and are not wrapped in envelope mode.
+func (s *JsonServer) writeStream(req *Request, res *Response) error {
+	first, err := res.stream.next()
+	if err != nil && err != io.EOF {
+		res.Error(err)
+		s.errors.resolve(res)
+		return s.writeError(req, res)
+	}
+	done := err == io.EOF
+
+	enc := s.jsonEncoder(req)
+	contentType := contentTypeJson
+	if res.stream.ndjson {
+		contentType, enc.indent = contentTypeNDJSON, ""
+	}
+	header := res.Writer.Header()
+	header.Set(contentTypeHeader, contentType)
+	header.Del(headerContentLength)
+	header.Add(headerTrailer, headerStreamError)
+	res.Writer.WriteHeader(res.Code)
+
+	w := res.Writer
+	if !res.stream.ndjson {
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+	}
+	item := first
+	for i := 0; !done; i++ {
+		if i > 0 && !res.stream.ndjson {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.encodeValue(w, item); err != nil {
+			return s.failStream(req, res, enc, &encodeError{err: err})
+		}
+		if (i+1)%streamFlushInterval == 0 {
+			flush(w)
+		}
+		if item, err = res.stream.next(); err == io.EOF {
+			done = true
+		} else if err != nil {
+			return s.failStream(req, res, enc, err)
+		}
+	}
+	if !res.stream.ndjson {
+		if _, err := io.WriteString(w, "]\n"); err != nil {
+			return err
+		}
+	}
+	flush(w)
+	return nil
+}
+
+// failStream reports an error after the headers have been sent
+func (s *JsonServer) failStream(req *Request, res *Response, enc jsonEncoder, err error) error {
+	res.Err = err
+	body := errorBody(req, err)
+	message, _ := body["error"].(string)
+	if message == "" {
+		message = http.StatusText(http.StatusInternalServerError)
+		body["error"] = message
+	}
+	if res.stream.ndjson {
+		if encErr := enc.Encode(res.Writer, body); encErr != nil {
+			req.Log(LevelError, "Error ending stream", Field{Key: "error", Value: encErr})
+		}
+	}
+	res.Writer.Header().Set(headerStreamError, message)
+	flush(res.Writer)
+	return errors.New("stream failed: " + err.Error())
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,118 @@
+package jsonserv
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func sliceIterator(items []interface{}, err error) Iterator {
+	i := 0
+	return func() (interface{}, error) {
+		if i == len(items) {
+			if err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		i++
+		return items[i-1], nil
+	}
+}
+
+func TestResponse_StreamArray(t *testing.T) {
+	s := viewServer(func(app interface{}, r *Request, out *Response) {
+		out.StreamArray(sliceIterator([]interface{}{1, "two", map[string]int{"three": 3}}, nil))
+	})
+	w := serve(s, http.MethodGet, "/")
+	if w.Code != http.StatusOK || w.Header().Get(contentTypeHeader) != contentTypeJson {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Header().Get(contentTypeHeader))
+	}
+	if w.Body.String() != "[1\n,\"two\"\n,{\"three\":3}\n]\n" {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+	if w.Header().Get(headerStreamError) != "" {
+		t.Fatalf("Unexpected trailer: %s", w.Header().Get(headerStreamError))
+	}
+}
+
+func TestResponse_Stream_nil_items(t *testing.T) {
+	for _, ndjson := range []bool{false, true} {
+		s := viewServer(func(app interface{}, r *Request, out *Response) {
+			items := sliceIterator([]interface{}{1, nil, 2}, nil)
+			if ndjson {
+				out.StreamNDJSON(items)
+			} else {
+				out.StreamArray(items)
+			}
+		})
+		w := serve(s, http.MethodGet, "/")
+		expected := "[1\n,null\n,2\n]\n"
+		if ndjson {
+			expected = "1\nnull\n2\n"
+		}
+		if w.Body.String() != expected {
+			t.Fatalf("Unexpected body: %q", w.Body.String())
+		}
+	}
+}
+
+func TestResponse_StreamArray_empty(t *testing.T) {
+	s := viewServer(func(app interface{}, r *Request, out *Response) {
+		out.StreamArray(sliceIterator(nil, nil))
+	})
+	w := serve(s, http.MethodGet, "/")
+	if w.Body.String() != "[]\n" {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+}
+
+func TestResponse_StreamArray_fails_partway(t *testing.T) {
+	s := viewServer(func(app interface{}, r *Request, out *Response) {
+		out.StreamArray(sliceIterator([]interface{}{1}, ErrConflict("Export interrupted")))
+	})
+	w := serve(s, http.MethodGet, "/")
+	if w.Code != http.StatusOK || w.Body.String() != "[1\n" {
+		t.Fatalf("Unexpected response: %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get(headerStreamError) != "Export interrupted" {
+		t.Fatalf("Unexpected trailer: %q", w.Header().Get(headerStreamError))
+	}
+}
+
+func TestResponse_StreamArray_fails_first(t *testing.T) {
+	s := viewServer(func(app interface{}, r *Request, out *Response) {
+		out.StreamArray(sliceIterator(nil, ErrNotFound("No rows")))
+	})
+	w := serve(s, http.MethodGet, "/")
+	if w.Code != http.StatusNotFound || w.Header().Get(contentTypeHeader) != contentTypeJson {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestResponse_StreamNDJSON_fails_partway(t *testing.T) {
+	s := viewServer(func(app interface{}, r *Request, out *Response) {
+		out.StreamNDJSON(sliceIterator([]interface{}{1, 2}, errors.New("database is down")))
+	})
+	w := serve(s, http.MethodGet, "/")
+	if w.Header().Get(contentTypeHeader) != contentTypeNDJSON {
+		t.Fatalf("Unexpected content type: %s", w.Header().Get(contentTypeHeader))
+	}
+	if w.Body.String() != "1\n2\n{\"error\":\"Internal Server Error\"}\n" {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+	if w.Header().Get(headerStreamError) != http.StatusText(http.StatusInternalServerError) {
+		t.Fatalf("Unexpected trailer: %q", w.Header().Get(headerStreamError))
+	}
+}
+
+func TestResponse_StreamNDJSON_accept(t *testing.T) {
+	s := viewServer(func(app interface{}, r *Request, out *Response) {
+		out.StreamNDJSON(sliceIterator([]interface{}{1}, nil))
+	})
+	w := serve(s, http.MethodGet, "/", withHeader(headerAccept, contentTypeNDJSON))
+	if w.Code != http.StatusOK || w.Header().Get(contentTypeHeader) != contentTypeNDJSON || w.Body.String() != "1\n" {
+		t.Fatalf("Unexpected response: %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+}
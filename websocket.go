@@ -0,0 +1,236 @@
+package jsonserv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Close codes of WebSocket connections
+const (
+	CloseNormal          = websocket.CloseNormalClosure
+	CloseGoingAway       = websocket.CloseGoingAway
+	CloseProtocolError   = websocket.CloseProtocolError
+	CloseUnsupportedData = websocket.CloseUnsupportedData
+	CloseMessageTooBig   = websocket.CloseMessageTooBig
+	ClosePolicyViolation = websocket.ClosePolicyViolation
+	CloseInternalError   = websocket.CloseInternalServerErr
+)
+
+const (
+	defaultWebSocketReadLimit    = 1 << 20
+	defaultWebSocketPingInterval = 30 * time.Second
+	defaultWebSocketWriteTimeout = 10 * time.Second
+	defaultWebSocketReceiveQueue = 16
+)
+
+// WebSocketHandler serves an upgraded connection. The connection is closed when it returns.
+type WebSocketHandler func(app interface{}, r *Request, conn *WebSocketConn)
+
+// WebSocketOptions configure WebSocket routes
+type WebSocketOptions struct {
+	// ReadLimit is the largest message accepted, 1MB if 0. Larger messages close the connection.
+	ReadLimit int64
+	// PingInterval is how often pings are sent, 30 seconds if 0. Connections that don't
+	// answer within two intervals are closed.
+	PingInterval time.Duration
+	// WriteTimeout is how long a message may take to send, 10 seconds if 0
+	WriteTimeout time.Duration
+	// ReceiveQueue is how many messages wait for Receive, 16 if 0. Messages that arrive while
+	// it is full are dropped, so pings and closes are still read when the handler only sends.
+	ReceiveQueue int
+	// CheckOrigin accepts the origin of an upgrade, same origin only if nil
+	CheckOrigin func(r *http.Request) bool
+	// Subprotocols are the subprotocols supported, preferred first
+	Subprotocols []string
+}
+
+// AddWebSocketRoute serves WebSocket connections on a path. Middleware Ingress runs before
+// the upgrade, and failing it or the upgrade responds with an error as usual. Egress runs
+// once the handler returns.
+func (s *JsonServer) AddWebSocketRoute(name, path string, handler WebSocketHandler) *JsonServer {
+	return s.AddRoute(http.MethodGet, name, path, func(app interface{}, r *Request, out *Response) {
+		s.serveWebSocket(app, r, out, handler)
+	})
+}
+
+// SetWebSocketOptions configures every WebSocket route
+func (s *JsonServer) SetWebSocketOptions(options WebSocketOptions) *JsonServer {
+	s.webSocketOptions = options
+	return s
+}
+
+func (s *JsonServer) serveWebSocket(app interface{}, req *Request, res *Response, handler WebSocketHandler) {
+	if res.Err != nil {
+		return
+	}
+	options := s.webSocketOptions
+	if options.ReadLimit <= 0 {
+		options.ReadLimit = defaultWebSocketReadLimit
+	}
+	if options.PingInterval <= 0 {
+		options.PingInterval = defaultWebSocketPingInterval
+	}
+	if options.WriteTimeout <= 0 {
+		options.WriteTimeout = defaultWebSocketWriteTimeout
+	}
+	if options.ReceiveQueue <= 0 {
+		options.ReceiveQueue = defaultWebSocketReceiveQueue
+	}
+	upgrader := websocket.Upgrader{
+		CheckOrigin:  options.CheckOrigin,
+		Subprotocols: options.Subprotocols,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			res.Error(NewHTTPError(status, "websocket_upgrade_failed", reason.Error()))
+		},
+	}
+	ws, err := upgrader.Upgrade(res.Writer, req.raw, nil)
+	if err != nil {
+		return
+	}
+	res.Code = http.StatusSwitchingProtocols
+	res.streamed = true
+
+	ctx, cancel := context.WithCancel(req.Context())
+	conn := &WebSocketConn{
+		conn:     ws,
+		ctx:      ctx,
+		cancel:   cancel,
+		options:  options,
+		messages: make(chan []byte, options.ReceiveQueue),
+	}
+	defer func() {
+		cancel()
+		conn.Close(CloseNormal, "")
+	}()
+	ws.SetReadLimit(options.ReadLimit)
+	pongWait := 2 * options.PingInterval
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	go conn.readPump()
+	go conn.keepAlive(options.PingInterval)
+	handler(app, req, conn)
+}
+
+// WebSocketConn is an upgraded connection exchanging JSON messages. Its methods may be
+// called concurrently.
+type WebSocketConn struct {
+	conn    *websocket.Conn
+	ctx     context.Context
+	cancel  context.CancelFunc
+	options WebSocketOptions
+	mu      sync.Mutex
+	closed  bool
+	// messages are queued by readPump for Receive, and closed once reading failed with readErr
+	messages chan []byte
+	readErr  error
+}
+
+// Context is done when the client disconnects or stops answering pings, the connection
+// closes or the handler returns
+func (c *WebSocketConn) Context() context.Context {
+	return c.ctx
+}
+
+// Subprotocol is the subprotocol negotiated with the client, empty if none
+func (c *WebSocketConn) Subprotocol() string {
+	return c.conn.Subprotocol()
+}
+
+// Send writes v as a JSON text message
+func (c *WebSocketConn) Send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return websocket.ErrCloseSent
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.options.WriteTimeout))
+	return c.conn.WriteJSON(v)
+}
+
+// Receive reads the next queued JSON message into v. Malformed messages fail with a 400 HTTPError
+// and leave the connection open. Use WebSocketCloseCode to tell if the client closed it.
+func (c *WebSocketConn) Receive(v interface{}) error {
+	message, ok := <-c.messages
+	if !ok {
+		return c.readErr
+	}
+	if err := json.NewDecoder(bytes.NewReader(message)).Decode(v); err != nil {
+		return ErrBadRequest("Malformed message").Wrap(err)
+	}
+	return nil
+}
+
+// Close sends a close frame with a code and reason and closes the connection
+func (c *WebSocketConn) Close(code int, reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	message := websocket.FormatCloseMessage(code, reason)
+	err := c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(c.options.WriteTimeout))
+	if closeErr := c.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readPump reads every frame, so pongs and close frames are handled even when the handler
+// only sends. The context is cancelled once reading fails.
+func (c *WebSocketConn) readPump() {
+	defer close(c.messages)
+	defer c.cancel()
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		select {
+		case c.messages <- message:
+		default:
+			// waiting for Receive would stop frames from being read
+		}
+	}
+}
+
+func (c *WebSocketConn) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			var err error
+			if !c.closed {
+				err = c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.options.WriteTimeout))
+			}
+			c.mu.Unlock()
+			if err != nil {
+				c.cancel()
+				return
+			}
+		}
+	}
+}
+
+// WebSocketCloseCode is the code a client closed the connection with, if err is a close
+func WebSocketCloseCode(err error) (int, bool) {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code, true
+	}
+	return 0, false
+}
@@ -0,0 +1,149 @@
+package jsonserv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWebSocket(t *testing.T, s *JsonServer, path string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	server := httptest.NewServer(s.createRouter())
+	t.Cleanup(server.Close)
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, header)
+}
+
+type denyMiddleware struct{}
+
+func (m denyMiddleware) Ingress(app interface{}, req *Request, res *Response) {
+	if req.Header().Get("Authorization") == "" {
+		res.Error(ErrUnauthorized("Missing credentials"))
+	}
+}
+
+func (m denyMiddleware) Egress(app interface{}, req *Request, res *Response) {}
+
+func echoServer() *JsonServer {
+	return New().AddMiddleware(NewGzipMiddleware()).AddMiddleware(denyMiddleware{}).
+		AddWebSocketRoute("Echo", "/echo", func(app interface{}, r *Request, conn *WebSocketConn) {
+			for {
+				var message map[string]interface{}
+				err := conn.Receive(&message)
+				if _, closed := WebSocketCloseCode(err); closed {
+					return
+				}
+				if err != nil {
+					conn.Send(map[string]string{"error": err.Error()})
+					continue
+				}
+				if message["close"] == true {
+					conn.Close(ClosePolicyViolation, "bye")
+					return
+				}
+				conn.Send(message)
+			}
+		})
+}
+
+func TestWebSocket_echo(t *testing.T) {
+	header := http.Header{"Authorization": {"token"}, headerAcceptEncoding: {"gzip"}}
+	conn, _, err := dialWebSocket(t, echoServer(), "/echo", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]string{"hello": "world"})
+	var reply map[string]string
+	if err := conn.ReadJSON(&reply); err != nil || reply["hello"] != "world" {
+		t.Fatalf("Unexpected reply: %v %v", reply, err)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte("{"))
+	if err := conn.ReadJSON(&reply); err != nil || !strings.HasPrefix(reply["error"], "Malformed message") {
+		t.Fatalf("Unexpected reply: %v %v", reply, err)
+	}
+
+	conn.WriteJSON(map[string]bool{"close": true})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	if code, ok := WebSocketCloseCode(err); !ok || code != ClosePolicyViolation {
+		t.Fatalf("Unexpected close: %v", err)
+	}
+}
+
+func TestWebSocket_ingress_before_upgrade(t *testing.T) {
+	_, res, err := dialWebSocket(t, echoServer(), "/echo", nil)
+	if err == nil || res == nil || res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected a 401, got %v %v", res, err)
+	}
+}
+
+func TestWebSocket_read_limit(t *testing.T) {
+	s := echoServer().SetWebSocketOptions(WebSocketOptions{ReadLimit: 16})
+	conn, _, err := dialWebSocket(t, s, "/echo", http.Header{"Authorization": {"token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(map[string]string{"message": strings.Repeat("a", 100)})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	if code, ok := WebSocketCloseCode(err); !ok || code != CloseMessageTooBig {
+		t.Fatalf("Unexpected close: %v", err)
+	}
+}
+
+func TestWebSocket_not_upgraded(t *testing.T) {
+	w, body := serveJSON(t, echoServer(), http.MethodGet, "/echo")
+	if w.Code != http.StatusUnauthorized || body["code"] != "unauthorized" {
+		t.Fatalf("Unexpected response: %d %v", w.Code, body)
+	}
+}
+
+func TestWebSocket_context_done_on_disconnect(t *testing.T) {
+	done := make(chan struct{})
+	s := New().AddWebSocketRoute("Ticks", "/ticks", func(app interface{}, r *Request, conn *WebSocketConn) {
+		conn.Send(map[string]int{"tick": 1})
+		<-conn.Context().Done()
+		close(done)
+	})
+	conn, _, err := dialWebSocket(t, s, "/ticks", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tick map[string]int
+	if err := conn.ReadJSON(&tick); err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(CloseGoingAway, ""))
+	conn.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Context not done after the client disconnected")
+	}
+}
+
+func TestWebSocket_send_only_sees_close(t *testing.T) {
+	done := make(chan struct{})
+	s := New().AddWebSocketRoute("Ticks", "/ticks", func(app interface{}, r *Request, conn *WebSocketConn) {
+		<-conn.Context().Done()
+		close(done)
+	})
+	conn, _, err := dialWebSocket(t, s, "/ticks", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(map[string]string{"ignored": "by the handler"})
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(CloseNormal, ""))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Context not done after the client closed")
+	}
+}
@@ -1,55 +1,194 @@
 package jsonserv
 
 import (
-	"encoding/json"
+	"bytes"
 	"errors"
-	"log"
+	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
 )
 
-func respond(req *Request, res *Response) {
+const (
+	headerContentLength = "Content-Length"
+	maxPooledBufferSize = 64 * 1024
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	// don't hold on to the occasional huge response
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+func (s *JsonServer) respond(req *Request, res *Response) {
+	if res.streamed {
+		return
+	}
 	var err error
 	if res.Err != nil {
-		err = writeError(req, res)
+		err = s.writeError(req, res)
+	} else if res.stream != nil {
+		err = s.writeStream(req, res)
 	} else {
-		err = writeBody(res)
+		err = s.writeBody(req, res)
 	}
 	if err != nil {
-		log.Printf("Error rendering %s: %v", req.URL(), err)
+		req.Log(LevelError, "Error rendering response", Field{Key: "error", Value: err})
 	}
 }
 
-func writeError(req *Request, res *Response) error {
+// writeError writes the status of the error. Messages of HTTPErrors are always shown,
+// internal errors are only shown in debug mode.
+func (s *JsonServer) writeError(req *Request, res *Response) error {
+	status := asHTTPError(res.Err).Status
+	contentType, body := contentTypeJson, interface{}(errorBody(req, res.Err))
+	if s.problemJSON {
+		contentType, body = contentTypeProblemJson, newProblem(req, res.Err)
+	}
+	if s.envelope {
+		contentType, body = contentTypeJson, newEnvelope(res, nil, body)
+	}
+	enc := s.jsonEncoder(req)
+	err := s.write(res.Writer, status, contentType, enc, body)
+	if _, ok := err.(*encodeError); ok {
+		// the details could not be encoded, send the status alone
+		if err := s.write(res.Writer, status, contentType, enc, nil); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// errorBody describes an error with the members clients may see
+func errorBody(req *Request, err error) map[string]interface{} {
 	body := make(map[string]interface{})
-	if req.GetOptionalMiddlewareVar(DebugFlag, false).(bool) {
-		body["error"] = res.Err.Error()
+	if id := req.RequestID(); id != "" {
+		body["request_id"] = id
+	}
+	debug := req.GetOptionalMiddlewareVar(DebugFlag, false).(bool)
+	httpErr := asHTTPError(err)
+	if httpErr.Status >= http.StatusInternalServerError && httpErr.Message == "" {
+		if debug {
+			body["error"] = err.Error()
+		}
+		return body
+	}
+	body["error"] = httpErr.message()
+	if httpErr.Code != "" {
+		body["code"] = httpErr.Code
+	}
+	if httpErr.Details != nil {
+		body["details"] = httpErr.Details
 	}
-	return write(res.Writer, http.StatusInternalServerError, body)
+	if debug && httpErr.Err != nil {
+		body["cause"] = httpErr.Err.Error()
+	}
+	return body
 }
 
-func writeBody(res *Response) error {
-	return write(res.Writer, res.Code, res.Body)
+// writeBody writes the body of a successful response. If the body can't be encoded
+// the response becomes a 500 instead, since nothing has been sent yet, or a 406 when
+// the encoder doesn't support the body.
+func (s *JsonServer) writeBody(req *Request, res *Response) error {
+	enc := res.encoder
+	if _, ok := enc.(jsonEncoder); ok || enc == nil || res.plain {
+		enc = s.jsonEncoder(req)
+	}
+	if !bodyAllowed(res.Code) {
+		res.Writer.WriteHeader(res.Code)
+		return nil
+	}
+	if notModified(req, res) {
+		return writeNotModified(res)
+	}
+	body := res.Body
+	if _, tabular := enc.(TabularEncoder); s.envelope && !tabular && !res.plain {
+		body = newEnvelope(res, body, nil)
+	}
+	if s.streaming {
+		return s.write(res.Writer, res.Code, enc.ContentType(), enc, body)
+	}
+	buf, err := encodeBuffer(enc, body)
+	if errors.Is(err, ErrUnsupportedBody) {
+		res.Error(errNotAcceptable())
+		return s.writeError(req, res)
+	}
+	if err != nil {
+		res.Error(err)
+		if err := s.writeError(req, res); err != nil {
+			return err
+		}
+		return err
+	}
+	defer putBuffer(buf)
+	if setHashETag(req, res, buf.Bytes()) && notModified(req, res) {
+		return writeNotModified(res)
+	}
+	return send(res.Writer, res.Code, enc.ContentType(), buf)
 }
 
-func write(w http.ResponseWriter, code int, body interface{}) error {
-	w.Header().Add(contentTypeHeader, contentTypeJson)
-	w.WriteHeader(code)
-	if body == nil {
-		return writeEmptyBody(w)
-	} else {
-		enc := json.NewEncoder(w)
-		return enc.Encode(body)
+// encodeError is returned by write when the body could not be encoded
+type encodeError struct {
+	err error
+}
+
+func (e *encodeError) Error() string {
+	return fmt.Sprintf("Error encoding body: %v", e.err)
+}
+
+func (e *encodeError) Unwrap() error {
+	return e.err
+}
+
+// write encodes the body into a buffer before sending any headers,
+// unless streaming is enabled
+func (s *JsonServer) write(w http.ResponseWriter, code int, contentType string, enc Encoder, body interface{}) error {
+	if s.streaming {
+		w.Header().Add(contentTypeHeader, contentType)
+		w.WriteHeader(code)
+		return enc.Encode(w, body)
+	}
+	buf, err := encodeBuffer(enc, body)
+	if err != nil {
+		return err
 	}
+	defer putBuffer(buf)
+	return send(w, code, contentType, buf)
 }
 
-func writeEmptyBody(w http.ResponseWriter) error {
-	if n, err := w.Write([]byte(emptyBody)); err != nil || n != len(emptyBody) {
-		if err != nil {
-			return err
-		} else {
-			return errors.New("Empty body not fully written")
-		}
-	} else {
-		return nil
+// encodeBuffer encodes the body into a pooled buffer
+func encodeBuffer(enc Encoder, body interface{}) (*bytes.Buffer, error) {
+	buf := getBuffer()
+	if err := enc.Encode(buf, body); err != nil {
+		putBuffer(buf)
+		return nil, &encodeError{err: err}
 	}
+	return buf, nil
+}
+
+// send writes an encoded body
+func send(w http.ResponseWriter, code int, contentType string, buf *bytes.Buffer) error {
+	w.Header().Add(contentTypeHeader, contentType)
+	w.Header().Set(headerContentLength, strconv.Itoa(buf.Len()))
+	w.WriteHeader(code)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// bodyAllowed reports if a status may have a body
+func bodyAllowed(code int) bool {
+	return (code < 100 || code >= 200) && code != http.StatusNoContent && code != http.StatusNotModified
 }
@@ -0,0 +1,70 @@
+package jsonserv
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestWriteBody_sets_content_length(t *testing.T) {
+	s := New().AddRoute(http.MethodGet, "Index", "/", func(app interface{}, r *Request, out *Response) {
+		out.Ok(map[string]string{"hello": "world"})
+	})
+	w, _ := serveJSON(t, s, http.MethodGet, "/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if w.Header().Get(headerContentLength) != strconv.Itoa(w.Body.Len()) {
+		t.Fatalf("Unexpected content length: %s", w.Header().Get(headerContentLength))
+	}
+}
+
+func TestWriteBody_encode_failure_is_500(t *testing.T) {
+	s := New().
+		AddMiddleware(NewDebugFlagMiddleware(true)).
+		AddRoute(http.MethodGet, "NaN", "/", func(app interface{}, r *Request, out *Response) {
+			out.Ok(map[string]float64{"value": math.NaN()})
+		})
+	w, body := serveJSON(t, s, http.MethodGet, "/")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Unexpected code: %d", w.Code)
+	}
+	if body["error"] == nil {
+		t.Fatalf("Unexpected body: %v", body)
+	}
+}
+
+func TestWriteError_unencodable_details(t *testing.T) {
+	writer := mockWriter()
+	req := newRequest(mockRequest())
+	res := newResponse(writer)
+	res.Error(ErrBadRequest("bad").WithDetails(make(chan int)))
+
+	err := New().writeError(req, res)
+	if _, ok := err.(*encodeError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if writer.Code != http.StatusBadRequest {
+		t.Fatalf("Unexpected code: %d", writer.Code)
+	}
+	if writer.Buffer.String() != emptyBody {
+		t.Fatalf("Unexpected body: %s", writer.Buffer.String())
+	}
+}
+
+func TestWrite_streaming(t *testing.T) {
+	writer := mockWriter()
+	err := New().SetStreaming(true).write(writer, http.StatusOK, contentTypeJson, jsonEncoder{}, make(chan int))
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	var encodeErr *encodeError
+	if errors.As(err, &encodeErr) {
+		t.Fatal("Streaming errors happen after the headers are sent")
+	}
+	if writer.Code != http.StatusOK {
+		t.Fatalf("Unexpected code: %d", writer.Code)
+	}
+}
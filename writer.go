@@ -0,0 +1,193 @@
+package jsonserv
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// WriterDecorator overrides methods of the writer it decorates. Nil methods fall through
+// to the decorated writer, and Flush is only used if the decorated writer can flush.
+type WriterDecorator struct {
+	Write       func(b []byte) (int, error)
+	WriteHeader func(code int)
+	Flush       func()
+	Close       func()
+}
+
+// DecoratedWriter is a ResponseWriter created by DecorateWriter
+type DecoratedWriter interface {
+	ResponseWriter
+	// Status is the status written through the writer, 0 until one is
+	Status() int
+	// BytesWritten is the number of body bytes written through the writer
+	BytesWritten() int64
+	// Unwrap is the decorated writer
+	Unwrap() http.ResponseWriter
+}
+
+// DecorateWriter wraps a writer, keeping the http.Flusher, http.Hijacker and io.ReaderFrom
+// interfaces it implements. The new writer records the status and bytes written through it.
+func DecorateWriter(w http.ResponseWriter, decorator WriterDecorator) DecoratedWriter {
+	d := &decoratedWriter{inner: w, decorator: decorator}
+	_, canFlush := w.(http.Flusher)
+	_, canHijack := w.(http.Hijacker)
+	_, canReadFrom := w.(io.ReaderFrom)
+	switch {
+	case canFlush && canHijack && canReadFrom:
+		return struct {
+			*decoratedWriter
+			flusher
+			hijacker
+			readerFrom
+		}{d, flusher{d}, hijacker{d}, readerFrom{d}}
+	case canFlush && canHijack:
+		return struct {
+			*decoratedWriter
+			flusher
+			hijacker
+		}{d, flusher{d}, hijacker{d}}
+	case canFlush && canReadFrom:
+		return struct {
+			*decoratedWriter
+			flusher
+			readerFrom
+		}{d, flusher{d}, readerFrom{d}}
+	case canHijack && canReadFrom:
+		return struct {
+			*decoratedWriter
+			hijacker
+			readerFrom
+		}{d, hijacker{d}, readerFrom{d}}
+	case canFlush:
+		return struct {
+			*decoratedWriter
+			flusher
+		}{d, flusher{d}}
+	case canHijack:
+		return struct {
+			*decoratedWriter
+			hijacker
+		}{d, hijacker{d}}
+	case canReadFrom:
+		return struct {
+			*decoratedWriter
+			readerFrom
+		}{d, readerFrom{d}}
+	}
+	return d
+}
+
+type decoratedWriter struct {
+	inner     http.ResponseWriter
+	decorator WriterDecorator
+	status    int
+	written   int64
+}
+
+func (d *decoratedWriter) Header() http.Header {
+	return d.inner.Header()
+}
+
+func (d *decoratedWriter) Write(b []byte) (int, error) {
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	var n int
+	var err error
+	if d.decorator.Write != nil {
+		n, err = d.decorator.Write(b)
+	} else {
+		n, err = d.inner.Write(b)
+	}
+	d.written += int64(n)
+	return n, err
+}
+
+func (d *decoratedWriter) WriteHeader(code int) {
+	if d.status == 0 {
+		d.status = code
+	}
+	if d.decorator.WriteHeader != nil {
+		d.decorator.WriteHeader(code)
+	} else {
+		d.inner.WriteHeader(code)
+	}
+}
+
+func (d *decoratedWriter) Close() {
+	if d.decorator.Close != nil {
+		d.decorator.Close()
+	} else if c, ok := d.inner.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
+
+func (d *decoratedWriter) Status() int {
+	return d.status
+}
+
+func (d *decoratedWriter) BytesWritten() int64 {
+	return d.written
+}
+
+func (d *decoratedWriter) Unwrap() http.ResponseWriter {
+	return d.inner
+}
+
+type flusher struct {
+	*decoratedWriter
+}
+
+func (f flusher) Flush() {
+	if f.decorator.Flush != nil {
+		f.decorator.Flush()
+	} else {
+		f.inner.(http.Flusher).Flush()
+	}
+}
+
+type hijacker struct {
+	*decoratedWriter
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.inner.(http.Hijacker).Hijack()
+}
+
+type readerFrom struct {
+	*decoratedWriter
+}
+
+// ReadFrom lets the decorated writer copy efficiently, unless Write is decorated
+func (r readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	if r.decorator.Write != nil {
+		return io.Copy(writerOnly{r.decoratedWriter}, src)
+	}
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.inner.(io.ReaderFrom).ReadFrom(src)
+	r.written += n
+	return n, err
+}
+
+// writerOnly hides ReadFrom from io.Copy
+type writerOnly struct {
+	io.Writer
+}
+
+// Written is the status and number of body bytes sent to the client so far, seen
+// through any decorators of the writer
+func (r *Response) Written() (status int, size int64) {
+	var w http.ResponseWriter = r.Writer
+	for {
+		if d, ok := w.(DecoratedWriter); ok {
+			status, size = d.Status(), d.BytesWritten()
+			w = d.Unwrap()
+			continue
+		}
+		return status, size
+	}
+}
@@ -0,0 +1,77 @@
+package jsonserv
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecorateWriter_keeps_interfaces(t *testing.T) {
+	w := DecorateWriter(httptest.NewRecorder(), WriterDecorator{})
+	if _, ok := w.(http.Flusher); !ok {
+		t.Fatal("Flusher dropped")
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		t.Fatal("Hijacker added")
+	}
+
+	mock := DecorateWriter(mockWriter(), WriterDecorator{})
+	if _, ok := mock.(http.Flusher); ok {
+		t.Fatal("Flusher added")
+	}
+	if mock.Unwrap() == nil {
+		t.Fatal("Unwrap lost the writer")
+	}
+}
+
+type readerFromWriter struct {
+	*mockResponseWriter
+	readFrom bool
+}
+
+func (w *readerFromWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.readFrom = true
+	return w.Buffer.ReadFrom(r)
+}
+
+func TestDecorateWriter_ReadFrom(t *testing.T) {
+	inner := &readerFromWriter{mockResponseWriter: mockWriter()}
+	w := DecorateWriter(inner, WriterDecorator{})
+	n, err := io.Copy(w, io.LimitReader(strings.NewReader("hello"), 5))
+	if err != nil || n != 5 || !inner.readFrom {
+		t.Fatalf("Unexpected copy: %d %v %v", n, err, inner.readFrom)
+	}
+	if w.Status() != http.StatusOK || w.BytesWritten() != 5 {
+		t.Fatalf("Unexpected record: %d %d", w.Status(), w.BytesWritten())
+	}
+
+	inner = &readerFromWriter{mockResponseWriter: mockWriter()}
+	upper := DecorateWriter(inner, WriterDecorator{Write: func(b []byte) (int, error) {
+		return inner.Write(bytes.ToUpper(b))
+	}})
+	io.Copy(upper, io.LimitReader(strings.NewReader("hello"), 5))
+	if inner.readFrom || inner.Buffer.String() != "HELLO" {
+		t.Fatalf("Decorated Write bypassed: %q", inner.Buffer.String())
+	}
+}
+
+func TestResponse_Written(t *testing.T) {
+	s := New().AddMiddleware(NewGzipMiddleware())
+	var status int
+	var size int64
+	s.AddMiddleware(egressFunc(func(res *Response) {
+		res.Writer.WriteHeader(http.StatusTeapot)
+		res.Writer.Write([]byte("hello, world"))
+		status, size = res.Written()
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	r.Header.Set(headerAcceptEncoding, headerAcceptEncodingGzip)
+	w := httptest.NewRecorder()
+	s.createRouter().ServeHTTP(w, r)
+	if status != http.StatusTeapot || size == 0 {
+		t.Fatalf("Unexpected record: %d %d", status, size)
+	}
+}